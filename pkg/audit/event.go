@@ -0,0 +1,36 @@
+package audit
+
+import (
+	"time"
+)
+
+// Action is what happened to a document.
+type Action string
+
+const (
+	// ActionOpen is a document opened in a WOPI app.
+	ActionOpen Action = "open"
+	// ActionOpenDenied is a document which may not be opened, the reason tells why.
+	ActionOpenDenied Action = "open-denied"
+	// ActionSave is a document saved by a WOPI app, either in place or as a new file.
+	ActionSave Action = "save"
+	// ActionClose is a document whose WOPI app released the lock at the end of the editing session.
+	// View-only and read-only sessions never lock their document, so they have no close event;
+	// they end when their access token expires.
+	ActionClose Action = "close"
+)
+
+// Event records who did what with which document.
+type Event struct {
+	Time      time.Time `json:"time"`
+	Action    Action    `json:"action"`
+	UserID    string    `json:"userid"`
+	UserName  string    `json:"username,omitempty"`
+	FileID    string    `json:"fileid"`
+	Path      string    `json:"path,omitempty"`
+	ViewMode  string    `json:"viewmode,omitempty"`
+	App       string    `json:"app,omitempty"`
+	ClientIP  string    `json:"clientip,omitempty"`
+	RequestID string    `json:"requestid,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+}
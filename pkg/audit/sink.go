@@ -0,0 +1,104 @@
+package audit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/owncloud/ocis-wopiserver/pkg/config"
+	"github.com/owncloud/ocis/ocis-pkg/log"
+)
+
+// Sinks which can be configured.
+const (
+	SinkNone = "none"
+	SinkLog  = "log"
+	SinkFile = "file"
+)
+
+// Sink writes audit events.
+type Sink interface {
+	Write(e Event) error
+	Close() error
+}
+
+// New returns the configured sink: the logger, a file of JSON lines, or none which discards the events.
+func New(cfg config.Audit, logger log.Logger) (Sink, error) {
+	switch cfg.Sink {
+	case SinkLog:
+		return NewLogSink(logger), nil
+	case SinkFile:
+		return NewFileSink(cfg.File)
+	case SinkNone, "":
+		return discard{}, nil
+	default:
+		return nil, fmt.Errorf("unknown audit sink %q", cfg.Sink)
+	}
+}
+
+// NewLogSink returns a sink which writes the events as info messages to the logger.
+func NewLogSink(logger log.Logger) Sink {
+	return logSink{logger: logger}
+}
+
+type logSink struct {
+	logger log.Logger
+}
+
+func (s logSink) Write(e Event) error {
+	s.logger.Info().
+		Time("time", e.Time).
+		Str("action", string(e.Action)).
+		Str("userid", e.UserID).
+		Str("username", e.UserName).
+		Str("fileid", e.FileID).
+		Str("path", e.Path).
+		Str("viewmode", e.ViewMode).
+		Str("app", e.App).
+		Str("clientip", e.ClientIP).
+		Str("requestid", e.RequestID).
+		Str("reason", e.Reason).
+		Msg("audit")
+	return nil
+}
+
+func (s logSink) Close() error {
+	return nil
+}
+
+// NewFileSink returns a sink which appends the events as JSON lines to the file.
+func NewFileSink(path string) (Sink, error) {
+	if path == "" {
+		return nil, errors.New("audit file missing")
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &fileSink{file: f, encoder: json.NewEncoder(f)}, nil
+}
+
+type fileSink struct {
+	mu      sync.Mutex
+	file    *os.File
+	encoder *json.Encoder
+}
+
+func (s *fileSink) Write(e Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.encoder.Encode(e)
+}
+
+func (s *fileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+type discard struct{}
+
+func (discard) Write(Event) error { return nil }
+func (discard) Close() error      { return nil }
@@ -0,0 +1,133 @@
+package breaker
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrOpen is returned for calls to a host whose circuit is open.
+var ErrOpen = errors.New("circuit breaker is open")
+
+// State is the state of a circuit breaker. The values are exported as metric, so they must not change.
+type State int
+
+const (
+	// Closed lets all calls pass.
+	Closed State = iota
+	// HalfOpen lets a single call pass to probe whether the host recovered.
+	HalfOpen
+	// Open rejects all calls until the cooldown has passed.
+	Open
+)
+
+func (s State) String() string {
+	switch s {
+	case HalfOpen:
+		return "half-open"
+	case Open:
+		return "open"
+	default:
+		return "closed"
+	}
+}
+
+// Breaker is the circuit breaker of a single host. It opens after a number of consecutive
+// failures and lets a probe pass once the cooldown has passed.
+type Breaker struct {
+	threshold int
+	cooldown  time.Duration
+	onChange  func(State)
+
+	mu       sync.Mutex
+	state    State
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func newBreaker(threshold int, cooldown time.Duration, onChange func(State)) *Breaker {
+	if threshold < 1 {
+		threshold = 1
+	}
+	return &Breaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		onChange:  onChange,
+	}
+}
+
+// Allow reports whether a call may pass. It returns ErrOpen while the circuit is open, and
+// while the probe of a half-open circuit is running.
+func (b *Breaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == Open && time.Since(b.openedAt) >= b.cooldown {
+		b.setState(HalfOpen)
+	}
+
+	switch b.state {
+	case Open:
+		return ErrOpen
+	case HalfOpen:
+		if b.probing {
+			return ErrOpen
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+// Success records a successful call, which closes the circuit.
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.probing = false
+	b.setState(Closed)
+}
+
+// Failure records a failed call. The circuit opens once the threshold of consecutive failures
+// is reached, or when the probe of a half-open circuit fails.
+func (b *Breaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.probing = false
+	if b.state == HalfOpen || b.failures >= b.threshold {
+		b.openedAt = time.Now()
+		b.setState(Open)
+	}
+}
+
+// Abort records a call whose outcome is unknown, e.g. because the caller canceled it.
+func (b *Breaker) Abort() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+}
+
+// State returns the state of the circuit.
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == Open && time.Since(b.openedAt) >= b.cooldown {
+		return HalfOpen
+	}
+	return b.state
+}
+
+func (b *Breaker) setState(s State) {
+	if b.state == s {
+		return
+	}
+	b.state = s
+	if b.onChange != nil {
+		b.onChange(s)
+	}
+}
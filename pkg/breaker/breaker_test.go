@@ -0,0 +1,113 @@
+package breaker
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	type step struct {
+		call    string
+		wantErr bool
+	}
+
+	tests := []struct {
+		name        string
+		threshold   int
+		cooldown    time.Duration
+		steps       []step
+		wantState   State
+		wantChanges []State
+	}{
+		{
+			name:      "opens after the threshold of consecutive failures",
+			threshold: 2,
+			cooldown:  time.Hour,
+			steps: []step{
+				{call: "allow"}, {call: "failure"},
+				{call: "allow"}, {call: "failure"},
+				{call: "allow", wantErr: true},
+			},
+			wantState:   Open,
+			wantChanges: []State{Open},
+		},
+		{
+			name:      "success resets the failures",
+			threshold: 2,
+			cooldown:  time.Hour,
+			steps: []step{
+				{call: "failure"}, {call: "success"}, {call: "failure"},
+				{call: "allow"},
+			},
+			wantState: Closed,
+		},
+		{
+			name:      "half-open lets a single probe pass",
+			threshold: 1,
+			cooldown:  0,
+			steps: []step{
+				{call: "failure"},
+				{call: "allow"},
+				{call: "allow", wantErr: true},
+				{call: "success"},
+				{call: "allow"}, {call: "allow"},
+			},
+			wantState:   Closed,
+			wantChanges: []State{Open, HalfOpen, Closed},
+		},
+		{
+			name:      "failed probe opens the circuit below the threshold",
+			threshold: 3,
+			cooldown:  0,
+			steps: []step{
+				{call: "failure"}, {call: "failure"}, {call: "failure"},
+				{call: "allow"}, {call: "failure"},
+			},
+			wantState:   HalfOpen,
+			wantChanges: []State{Open, HalfOpen, Open},
+		},
+		{
+			name:      "aborted probe lets the next probe pass",
+			threshold: 1,
+			cooldown:  0,
+			steps: []step{
+				{call: "failure"},
+				{call: "allow"},
+				{call: "abort"},
+				{call: "allow"},
+				{call: "allow", wantErr: true},
+			},
+			wantState:   HalfOpen,
+			wantChanges: []State{Open, HalfOpen},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var changes []State
+			b := newBreaker(tt.threshold, tt.cooldown, func(s State) { changes = append(changes, s) })
+
+			for i, s := range tt.steps {
+				switch s.call {
+				case "allow":
+					if err := b.Allow(); (err != nil) != s.wantErr {
+						t.Fatalf("step %d: Allow() error = %v, wantErr %v", i, err, s.wantErr)
+					}
+				case "success":
+					b.Success()
+				case "failure":
+					b.Failure()
+				case "abort":
+					b.Abort()
+				}
+			}
+
+			if got := b.State(); got != tt.wantState {
+				t.Errorf("State() = %s, want %s", got, tt.wantState)
+			}
+			if !reflect.DeepEqual(changes, tt.wantChanges) {
+				t.Errorf("state changes = %v, want %v", changes, tt.wantChanges)
+			}
+		})
+	}
+}
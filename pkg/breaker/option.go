@@ -0,0 +1,47 @@
+package breaker
+
+import (
+	"time"
+)
+
+// Option defines a single option function.
+type Option func(o *Options)
+
+// Options defines the available options for this package.
+type Options struct {
+	Threshold     int
+	Cooldown      time.Duration
+	OnStateChange func(host string, state State)
+}
+
+// newOptions initializes the available default options.
+func newOptions(opts ...Option) Options {
+	opt := Options{}
+
+	for _, o := range opts {
+		o(&opt)
+	}
+
+	return opt
+}
+
+// Threshold provides a function to set the threshold option, the number of consecutive failures opening a circuit.
+func Threshold(val int) Option {
+	return func(o *Options) {
+		o.Threshold = val
+	}
+}
+
+// Cooldown provides a function to set the cooldown option, the time an open circuit rejects calls.
+func Cooldown(val time.Duration) Option {
+	return func(o *Options) {
+		o.Cooldown = val
+	}
+}
+
+// OnStateChange provides a function to set the function called when the state of a circuit changes.
+func OnStateChange(val func(host string, state State)) Option {
+	return func(o *Options) {
+		o.OnStateChange = val
+	}
+}
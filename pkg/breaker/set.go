@@ -0,0 +1,52 @@
+package breaker
+
+import (
+	"sort"
+	"sync"
+)
+
+// Set holds the circuit breakers of the hosts, which are created on first use.
+type Set struct {
+	options Options
+
+	mu       sync.Mutex
+	breakers map[string]*Breaker
+}
+
+// NewSet returns an empty set of circuit breakers.
+func NewSet(opts ...Option) *Set {
+	return &Set{
+		options:  newOptions(opts...),
+		breakers: map[string]*Breaker{},
+	}
+}
+
+// Get returns the circuit breaker of the host.
+func (s *Set) Get(host string) *Breaker {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.breakers[host]
+	if !ok {
+		var onChange func(State)
+		if s.options.OnStateChange != nil {
+			onChange = func(state State) { s.options.OnStateChange(host, state) }
+		}
+		b = newBreaker(s.options.Threshold, s.options.Cooldown, onChange)
+		s.breakers[host] = b
+	}
+	return b
+}
+
+// Hosts returns the hosts which have a circuit breaker, sorted by name.
+func (s *Set) Hosts() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hosts := make([]string, 0, len(s.breakers))
+	for host := range s.breakers {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	return hosts
+}
@@ -6,6 +6,8 @@ import (
 
 	"github.com/micro/cli/v2"
 	"github.com/oklog/run"
+	"github.com/owncloud/ocis-wopiserver/pkg/audit"
+	"github.com/owncloud/ocis-wopiserver/pkg/breaker"
 	"github.com/owncloud/ocis-wopiserver/pkg/config"
 	"github.com/owncloud/ocis-wopiserver/pkg/flagset"
 	"github.com/owncloud/ocis-wopiserver/pkg/metrics"
@@ -49,13 +51,28 @@ func Server(cfg *config.Config) *cli.Command {
 					}
 					return context.WithCancel(cfg.Context)
 				}()
-				mtrcs = metrics.New()
+				mtrcs    = metrics.New()
+				breakers = breaker.NewSet(
+					breaker.Threshold(cfg.WopiServer.BreakerThreshold),
+					breaker.Cooldown(cfg.WopiServer.BreakerCooldown),
+					breaker.OnStateChange(func(host string, state breaker.State) {
+						mtrcs.BreakerState.WithLabelValues(host).Set(float64(state))
+						logger.Warn().Str("host", host).Str("state", state.String()).Msg("circuit breaker of WOPI host changed")
+					}),
+				)
 			)
 
 			defer cancel()
 
 			mtrcs.BuildInfo.WithLabelValues(cfg.Server.Version).Set(1)
 
+			auditSink, err := audit.New(cfg.Audit, logger)
+			if err != nil {
+				logger.Error().Err(err).Str("sink", cfg.Audit.Sink).Msg("Failed to initialize audit sink")
+				return err
+			}
+			defer auditSink.Close()
+
 			{
 				server, err := http.Server(
 					http.Logger(logger),
@@ -63,6 +80,8 @@ func Server(cfg *config.Config) *cli.Command {
 					http.Namespace(cfg.HTTP.Namespace),
 					http.Config(cfg),
 					http.Metrics(mtrcs),
+					http.Breakers(breakers),
+					http.Audit(auditSink),
 				)
 
 				if err != nil {
@@ -93,6 +112,7 @@ func Server(cfg *config.Config) *cli.Command {
 					debug.Logger(logger),
 					debug.Context(ctx),
 					debug.Config(cfg),
+					debug.Breakers(breakers),
 				)
 
 				if err != nil {
@@ -59,13 +59,109 @@ type Asset struct {
 type TokenManager struct {
 	JWTSecret string
 	TokenTTL  time.Duration
+
+	// ViewTokenTTL is the lifetime of the tokens of view-only and read-only sessions.
+	ViewTokenTTL time.Duration
+	// EditTokenTTL is the lifetime of the tokens of read-write sessions.
+	EditTokenTTL time.Duration
+}
+
+// WopiApp defines a WOPI app (e.g. Collabora or OnlyOffice) files can be opened with.
+type WopiApp struct {
+	Name string
+	// Host is the URL under which the app publishes the WOPI discovery.
+	Host string
+	// Priority decides between apps handling the same extension, the highest wins.
+	Priority int
+	// Extensions restricts the app to these extensions, all extensions of its discovery if empty.
+	Extensions []string
+	// DisabledExtensions are never opened with the app.
+	DisabledExtensions []string
 }
 
+// WopiServer defines the available WOPI server configuration.
 type WopiServer struct {
 	Host        string
 	Insecure    bool
 	RevaGateway string
 	IOPSecret   string
+
+	// AppHost is the WOPI app (e.g. Collabora) which publishes the WOPI discovery.
+	// It is only used if no Apps are configured.
+	AppHost string
+	// Apps are the WOPI apps files can be opened with.
+	Apps []WopiApp
+	// MimeTypeAliases map MIME types to the extension whose handlers open them, e.g. flat ODF to odt.
+	MimeTypeAliases map[string]string
+	// DiscoveryTTL is the time after which the cached WOPI discoveries get refreshed.
+	DiscoveryTTL time.Duration
+
+	// GatewayTimeout bounds every call to the reva gateway.
+	GatewayTimeout time.Duration
+	// DiscoveryTimeout bounds fetching the WOPI discovery of an app.
+	DiscoveryTimeout time.Duration
+	// IOPTimeout bounds opening a file with the CS3 WOPI server.
+	IOPTimeout time.Duration
+
+	// RetryAttempts is how often idempotent calls to the WOPI hosts (the WOPI apps and the CS3 WOPI server)
+	// are tried before giving up.
+	RetryAttempts int
+	// RetryBackoff is the wait before the first retry. It doubles with every retry and is jittered.
+	RetryBackoff time.Duration
+	// BreakerThreshold is the number of consecutive failures which open the circuit of a WOPI host.
+	BreakerThreshold int
+	// BreakerCooldown is the time an open circuit fails calls right away before a call may probe the host.
+	BreakerCooldown time.Duration
+
+	// Builtin serves the WOPI endpoints from this service instead of the CS3 WOPI server.
+	Builtin bool
+	// PublicURL is the URL under which WOPI clients reach this service.
+	PublicURL string
+	// Secret signs the access tokens handed to WOPI clients by the built-in WOPI endpoints.
+	Secret string
+	// GuestName is the display name of users opening files through a public share.
+	GuestName string
+	// EnforceProofKeys rejects WOPI requests which are not signed with the proof keys of the WOPI app.
+	EnforceProofKeys bool
+}
+
+// DefaultAppName is the name of the WOPI app at AppHost, used if no Apps are configured.
+const DefaultAppName = "default"
+
+// WopiApps returns the configured WOPI apps, or the app at AppHost if none are configured.
+// Apps without a name are named after their host.
+func (c WopiServer) WopiApps() []WopiApp {
+	if len(c.Apps) == 0 {
+		return []WopiApp{{Name: DefaultAppName, Host: c.AppHost}}
+	}
+
+	apps := make([]WopiApp, 0, len(c.Apps))
+	for _, app := range c.Apps {
+		if app.Name == "" {
+			app.Name = app.Host
+		}
+		apps = append(apps, app)
+	}
+	return apps
+}
+
+// WopiClient defines the default options added to the WOPI client URL.
+// They can be overridden per request by the query parameters of the same name.
+type WopiClient struct {
+	// Lang is the fallback language if neither the request nor the browser asks for one.
+	Lang            string
+	CloseButton     bool
+	RevisionHistory bool
+	// UIDefaults are the Collabora UI defaults, e.g. "UIMode=tabbed;TextRuler=false".
+	UIDefaults string
+}
+
+// Audit defines where the audit events of opened, saved and closed documents are written.
+type Audit struct {
+	// Sink is "log", "file" or "none".
+	Sink string
+	// File receives the events as JSON lines if the sink is "file".
+	File string
 }
 
 // Config combines all available configuration parts.
@@ -80,6 +176,8 @@ type Config struct {
 	TokenManager TokenManager
 
 	WopiServer WopiServer
+	WopiClient WopiClient
+	Audit      Audit
 
 	Context    context.Context
 	Supervised bool
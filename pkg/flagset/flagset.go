@@ -185,6 +185,139 @@ func ServerWithConfig(cfg *config.Config) []cli.Flag {
 			EnvVars:     []string{"WOPISERVER_WOPI_SERVER_IOP_SECRET"},
 			Destination: &cfg.WopiServer.IOPSecret,
 		},
+		&cli.StringFlag{
+			Name:        "wopi-app-host",
+			Value:       flags.OverrideDefaultString(cfg.WopiServer.AppHost, "https://127.0.0.1:9980"),
+			Usage:       "WOPI app host serving the WOPI discovery on /hosting/discovery",
+			EnvVars:     []string{"WOPISERVER_WOPI_APP_HOST"},
+			Destination: &cfg.WopiServer.AppHost,
+		},
+		&cli.DurationFlag{
+			Name:        "wopi-app-discovery-ttl",
+			Value:       (10 * time.Minute),
+			Usage:       "Refresh interval of the cached WOPI discovery",
+			EnvVars:     []string{"WOPISERVER_WOPI_APP_DISCOVERY_TTL"},
+			Destination: &cfg.WopiServer.DiscoveryTTL,
+		},
+		&cli.DurationFlag{
+			Name:        "wopi-app-discovery-timeout",
+			Value:       (10 * time.Second),
+			Usage:       "Timeout for fetching the WOPI discovery",
+			EnvVars:     []string{"WOPISERVER_WOPI_APP_DISCOVERY_TIMEOUT"},
+			Destination: &cfg.WopiServer.DiscoveryTimeout,
+		},
+		&cli.DurationFlag{
+			Name:        "wopi-server-iop-timeout",
+			Value:       (10 * time.Second),
+			Usage:       "Timeout for opening a file with the CS3 WOPI server",
+			EnvVars:     []string{"WOPISERVER_WOPI_SERVER_IOP_TIMEOUT"},
+			Destination: &cfg.WopiServer.IOPTimeout,
+		},
+		&cli.IntFlag{
+			Name:        "wopi-host-retry-attempts",
+			Value:       3,
+			Usage:       "Attempts of idempotent calls to the WOPI hosts",
+			EnvVars:     []string{"WOPISERVER_WOPI_HOST_RETRY_ATTEMPTS"},
+			Destination: &cfg.WopiServer.RetryAttempts,
+		},
+		&cli.DurationFlag{
+			Name:        "wopi-host-retry-backoff",
+			Value:       (200 * time.Millisecond),
+			Usage:       "Wait before the first retry of a call to a WOPI host",
+			EnvVars:     []string{"WOPISERVER_WOPI_HOST_RETRY_BACKOFF"},
+			Destination: &cfg.WopiServer.RetryBackoff,
+		},
+		&cli.IntFlag{
+			Name:        "wopi-host-breaker-threshold",
+			Value:       5,
+			Usage:       "Consecutive failures which open the circuit breaker of a WOPI host",
+			EnvVars:     []string{"WOPISERVER_WOPI_HOST_BREAKER_THRESHOLD"},
+			Destination: &cfg.WopiServer.BreakerThreshold,
+		},
+		&cli.DurationFlag{
+			Name:        "wopi-host-breaker-cooldown",
+			Value:       (30 * time.Second),
+			Usage:       "Time an open circuit breaker fails calls to a WOPI host right away",
+			EnvVars:     []string{"WOPISERVER_WOPI_HOST_BREAKER_COOLDOWN"},
+			Destination: &cfg.WopiServer.BreakerCooldown,
+		},
+		&cli.BoolFlag{
+			Name:        "wopi-server-builtin",
+			Value:       false,
+			Usage:       "Serve the WOPI endpoints from this service instead of the CS3 WOPI server",
+			EnvVars:     []string{"WOPISERVER_WOPI_SERVER_BUILTIN"},
+			Destination: &cfg.WopiServer.Builtin,
+		},
+		&cli.StringFlag{
+			Name:        "wopi-server-public-url",
+			Value:       flags.OverrideDefaultString(cfg.WopiServer.PublicURL, "http://127.0.0.1:9105"),
+			Usage:       "URL under which WOPI clients reach the built-in WOPI endpoints",
+			EnvVars:     []string{"WOPISERVER_WOPI_SERVER_PUBLIC_URL"},
+			Destination: &cfg.WopiServer.PublicURL,
+		},
+		&cli.StringFlag{
+			Name:        "wopi-server-secret",
+			Value:       flags.OverrideDefaultString(cfg.WopiServer.Secret, "eiKoh5ohque1"),
+			Usage:       "Used to sign the access tokens handed to WOPI clients by the built-in WOPI endpoints",
+			EnvVars:     []string{"WOPISERVER_WOPI_SERVER_SECRET"},
+			Destination: &cfg.WopiServer.Secret,
+		},
+		&cli.StringFlag{
+			Name:        "wopi-server-guest-name",
+			Value:       flags.OverrideDefaultString(cfg.WopiServer.GuestName, "Guest"),
+			Usage:       "Display name of users opening files through a public share",
+			EnvVars:     []string{"WOPISERVER_WOPI_SERVER_GUEST_NAME"},
+			Destination: &cfg.WopiServer.GuestName,
+		},
+		&cli.BoolFlag{
+			Name:        "wopi-server-enforce-proof-keys",
+			Value:       false,
+			Usage:       "Reject WOPI requests which are not signed with the proof keys of the WOPI app",
+			EnvVars:     []string{"WOPISERVER_WOPI_SERVER_ENFORCE_PROOF_KEYS"},
+			Destination: &cfg.WopiServer.EnforceProofKeys,
+		},
+		&cli.StringFlag{
+			Name:        "wopi-client-lang",
+			Value:       flags.OverrideDefaultString(cfg.WopiClient.Lang, "en"),
+			Usage:       "Default language of the WOPI client",
+			EnvVars:     []string{"WOPISERVER_WOPI_CLIENT_LANG"},
+			Destination: &cfg.WopiClient.Lang,
+		},
+		&cli.BoolFlag{
+			Name:        "wopi-client-closebutton",
+			Value:       true,
+			Usage:       "Show a close button in the WOPI client",
+			EnvVars:     []string{"WOPISERVER_WOPI_CLIENT_CLOSEBUTTON"},
+			Destination: &cfg.WopiClient.CloseButton,
+		},
+		&cli.BoolFlag{
+			Name:        "wopi-client-revisionhistory",
+			Value:       false,
+			Usage:       "Show the revision history in the WOPI client",
+			EnvVars:     []string{"WOPISERVER_WOPI_CLIENT_REVISIONHISTORY"},
+			Destination: &cfg.WopiClient.RevisionHistory,
+		},
+		&cli.StringFlag{
+			Name:        "wopi-client-ui-defaults",
+			Value:       flags.OverrideDefaultString(cfg.WopiClient.UIDefaults, ""),
+			Usage:       "UI defaults of the WOPI client (Collabora ui_defaults)",
+			EnvVars:     []string{"WOPISERVER_WOPI_CLIENT_UI_DEFAULTS"},
+			Destination: &cfg.WopiClient.UIDefaults,
+		},
+		&cli.StringFlag{
+			Name:        "audit-sink",
+			Value:       flags.OverrideDefaultString(cfg.Audit.Sink, "log"),
+			Usage:       "Sink of the audit events: log, file or none",
+			EnvVars:     []string{"WOPISERVER_AUDIT_SINK"},
+			Destination: &cfg.Audit.Sink,
+		},
+		&cli.StringFlag{
+			Name:        "audit-file",
+			Value:       flags.OverrideDefaultString(cfg.Audit.File, ""),
+			Usage:       "File the audit events are appended to as JSON lines if the sink is file",
+			EnvVars:     []string{"WOPISERVER_AUDIT_FILE"},
+			Destination: &cfg.Audit.File,
+		},
 		&cli.DurationFlag{
 			Name:        "wopi-server-token-ttl",
 			Value:       (1 * time.Hour),
@@ -192,6 +325,20 @@ func ServerWithConfig(cfg *config.Config) []cli.Flag {
 			EnvVars:     []string{"WOPISERVER_TOKEN_TTL"},
 			Destination: &cfg.TokenManager.TokenTTL,
 		},
+		&cli.DurationFlag{
+			Name:        "wopi-server-view-token-ttl",
+			Value:       (1 * time.Hour),
+			Usage:       "TTL of tokens issued for view-only and read-only sessions",
+			EnvVars:     []string{"WOPISERVER_VIEW_TOKEN_TTL"},
+			Destination: &cfg.TokenManager.ViewTokenTTL,
+		},
+		&cli.DurationFlag{
+			Name:        "wopi-server-edit-token-ttl",
+			Value:       (8 * time.Hour),
+			Usage:       "TTL of tokens issued for read-write sessions",
+			EnvVars:     []string{"WOPISERVER_EDIT_TOKEN_TTL"},
+			Destination: &cfg.TokenManager.EditTokenTTL,
+		},
 
 		&cli.StringFlag{
 			Name:        "jwt-secret",
@@ -207,5 +354,12 @@ func ServerWithConfig(cfg *config.Config) []cli.Flag {
 			EnvVars:     []string{"WOPISERVER_REVA_GATEWAY_ADDR"},
 			Destination: &cfg.WopiServer.RevaGateway,
 		},
+		&cli.DurationFlag{
+			Name:        "reva-gateway-timeout",
+			Value:       (10 * time.Second),
+			Usage:       "Timeout for calls to the reva gateway",
+			EnvVars:     []string{"WOPISERVER_REVA_GATEWAY_TIMEOUT"},
+			Destination: &cfg.WopiServer.GatewayTimeout,
+		},
 	}
 }
@@ -15,9 +15,15 @@ var (
 // Metrics defines the available metrics of this service.
 type Metrics struct {
 	BuildInfo *prometheus.GaugeVec
-	Counter   *prometheus.CounterVec
-	Latency   *prometheus.SummaryVec
-	Duration  *prometheus.HistogramVec
+
+	DocumentsOpened  *prometheus.CounterVec
+	OpenDuration     *prometheus.HistogramVec
+	UpstreamDuration *prometheus.HistogramVec
+	UpstreamErrors   *prometheus.CounterVec
+	UpstreamRetries  *prometheus.CounterVec
+	BreakerState     *prometheus.GaugeVec
+
+	DiscoveryFetched *prometheus.GaugeVec
 }
 
 // New initializes the available metrics.
@@ -31,24 +37,48 @@ func New(opts ...Option) *Metrics {
 			Name:      "build_info",
 			Help:      "Build information",
 		}, []string{"version"}),
-		Counter: prometheus.NewCounterVec(prometheus.CounterOpts{
+		DocumentsOpened: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: Subsystem,
+			Name:      "documents_opened_total",
+			Help:      "How many documents were opened",
+		}, []string{"extension", "app", "mode"}),
+		OpenDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Subsystem: Subsystem,
+			Name:      "open_duration_seconds",
+			Help:      "Time to answer requests opening or creating a document in seconds",
+		}, []string{"endpoint"}),
+		UpstreamDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Subsystem: Subsystem,
+			Name:      "upstream_duration_seconds",
+			Help:      "Duration of the calls to the CS3 gateway, the WOPI apps and the CS3 WOPI server in seconds",
+		}, []string{"upstream"}),
+		UpstreamErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
 			Namespace: Namespace,
 			Subsystem: Subsystem,
-			Name:      "greet_total",
-			Help:      "How many greeting requests processed",
-		}, []string{}),
-		Latency: prometheus.NewSummaryVec(prometheus.SummaryOpts{
+			Name:      "upstream_errors_total",
+			Help:      "How many calls to the CS3 gateway, the WOPI apps and the CS3 WOPI server failed",
+		}, []string{"upstream"}),
+		UpstreamRetries: prometheus.NewCounterVec(prometheus.CounterOpts{
 			Namespace: Namespace,
 			Subsystem: Subsystem,
-			Name:      "greet_latency_microseconds",
-			Help:      "Greet request latencies in microseconds",
-		}, []string{}),
-		Duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:      "upstream_retries_total",
+			Help:      "How many calls to the WOPI hosts were retried",
+		}, []string{"host"}),
+		BreakerState: prometheus.NewGaugeVec(prometheus.GaugeOpts{
 			Namespace: Namespace,
 			Subsystem: Subsystem,
-			Name:      "greet_duration_seconds",
-			Help:      "Greet method request time in seconds",
-		}, []string{}),
+			Name:      "circuit_breaker_state",
+			Help:      "State of the circuit breaker of a WOPI host: 0 closed, 1 half-open, 2 open",
+		}, []string{"host"}),
+		DiscoveryFetched: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Subsystem: Subsystem,
+			Name:      "discovery_fetched_timestamp_seconds",
+			Help:      "Unix time at which the cached WOPI discovery was fetched",
+		}, []string{"host"}),
 	}
 
 	if err := prometheus.Register(m.BuildInfo); err != nil {
@@ -58,26 +88,67 @@ func New(opts ...Option) *Metrics {
 			Msg("Failed to register prometheus metric")
 	}
 
-	if err := prometheus.Register(m.Counter); err != nil {
+	if err := prometheus.Register(m.DocumentsOpened); err != nil {
+		options.Logger.Error().
+			Err(err).
+			Str("metric", "documents_opened").
+			Msg("Failed to register prometheus metric")
+	}
+
+	if err := prometheus.Register(m.OpenDuration); err != nil {
+		options.Logger.Error().
+			Err(err).
+			Str("metric", "open_duration").
+			Msg("Failed to register prometheus metric")
+	}
+
+	if err := prometheus.Register(m.UpstreamDuration); err != nil {
+		options.Logger.Error().
+			Err(err).
+			Str("metric", "upstream_duration").
+			Msg("Failed to register prometheus metric")
+	}
+
+	if err := prometheus.Register(m.UpstreamErrors); err != nil {
+		options.Logger.Error().
+			Err(err).
+			Str("metric", "upstream_errors").
+			Msg("Failed to register prometheus metric")
+	}
+
+	if err := prometheus.Register(m.UpstreamRetries); err != nil {
 		options.Logger.Error().
 			Err(err).
-			Str("metric", "counter").
+			Str("metric", "upstream_retries").
 			Msg("Failed to register prometheus metric")
 	}
 
-	if err := prometheus.Register(m.Latency); err != nil {
+	if err := prometheus.Register(m.BreakerState); err != nil {
 		options.Logger.Error().
 			Err(err).
-			Str("metric", "latency").
+			Str("metric", "circuit_breaker_state").
 			Msg("Failed to register prometheus metric")
 	}
 
-	if err := prometheus.Register(m.Duration); err != nil {
+	if err := prometheus.Register(m.DiscoveryFetched); err != nil {
 		options.Logger.Error().
 			Err(err).
-			Str("metric", "duration").
+			Str("metric", "discovery_fetched_timestamp").
 			Msg("Failed to register prometheus metric")
 	}
 
 	return m
 }
+
+// RegisterActiveSessions registers the gauge of the editing sessions holding a WOPI lock on this
+// instance. It calls active whenever it is scraped, so it also drops sessions whose lock expired.
+func (m *Metrics) RegisterActiveSessions(active func() int) error {
+	return prometheus.Register(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Subsystem: Subsystem,
+		Name:      "active_sessions",
+		Help:      "Editing sessions holding a WOPI lock on this instance",
+	}, func() float64 {
+		return float64(active())
+	}))
+}
@@ -0,0 +1,190 @@
+package debug
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	gateway "github.com/cs3org/go-cs3apis/cs3/gateway/v1beta1"
+	"github.com/cs3org/reva/pkg/rgrpc/todo/pool"
+	"github.com/owncloud/ocis-wopiserver/pkg/breaker"
+	"github.com/owncloud/ocis-wopiserver/pkg/config"
+)
+
+// checkTimeout is the time a single readiness check may take.
+const checkTimeout = 5 * time.Second
+
+const (
+	checkStatusOK     = "ok"
+	checkStatusFailed = "failed"
+)
+
+// checkResult is the state of a dependency.
+type checkResult struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// readiness is the response of the ready check.
+type readiness struct {
+	Status string        `json:"status"`
+	Checks []checkResult `json:"checks"`
+}
+
+// check verifies that a dependency is usable.
+type check struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+// checks returns the readiness checks of the dependencies: the reva gateway, the discovery of
+// every WOPI app, the IOP secret of the CS3 WOPI server unless the WOPI endpoints are built in,
+// and the circuit breakers of the WOPI hosts.
+func checks(cfg *config.Config, breakers *breaker.Set) []check {
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: cfg.WopiServer.Insecure,
+		},
+	}}
+
+	checks := []check{{
+		name: "gateway",
+		run: func(ctx context.Context) error {
+			return checkGateway(ctx, cfg.WopiServer.RevaGateway)
+		},
+	}}
+
+	for _, app := range cfg.WopiServer.WopiApps() {
+		host := app.Host
+		checks = append(checks, check{
+			name: "discovery:" + app.Name,
+			run: func(ctx context.Context) error {
+				return checkDiscovery(ctx, client, host)
+			},
+		})
+	}
+
+	if !cfg.WopiServer.Builtin {
+		checks = append(checks, check{
+			name: "iop",
+			run: func(ctx context.Context) error {
+				return checkIOPSecret(ctx, client, cfg.WopiServer.Host, cfg.WopiServer.IOPSecret)
+			},
+		})
+	}
+
+	if breakers != nil {
+		checks = append(checks, check{
+			name: "circuitbreakers",
+			run: func(ctx context.Context) error {
+				return checkBreakers(breakers)
+			},
+		})
+	}
+
+	return checks
+}
+
+// runChecks runs the checks concurrently.
+func runChecks(ctx context.Context, checks []check) readiness {
+	results := make([]checkResult, len(checks))
+
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c check) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+			defer cancel()
+
+			results[i] = checkResult{Name: c.name, Status: checkStatusOK}
+			if err := c.run(ctx); err != nil {
+				results[i].Status = checkStatusFailed
+				results[i].Error = err.Error()
+			}
+		}(i, c)
+	}
+	wg.Wait()
+
+	r := readiness{Status: checkStatusOK, Checks: results}
+	for _, result := range results {
+		if result.Status != checkStatusOK {
+			r.Status = checkStatusFailed
+		}
+	}
+	return r
+}
+
+// checkGateway verifies that the reva gateway answers. Any response, even an unauthenticated one, proves the connection.
+func checkGateway(ctx context.Context, addr string) error {
+	gc, err := pool.GetGatewayServiceClient(addr)
+	if err != nil {
+		return err
+	}
+	_, err = gc.WhoAmI(ctx, &gateway.WhoAmIRequest{})
+	return err
+}
+
+// checkDiscovery verifies that the WOPI app serves its discovery.
+func checkDiscovery(ctx context.Context, client *http.Client, host string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(host, "/")+"/hosting/discovery", nil)
+	if err != nil {
+		return err
+	}
+
+	rsp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusOK {
+		return fmt.Errorf("get /hosting/discovery failed: status code %d", rsp.StatusCode)
+	}
+	return nil
+}
+
+// checkIOPSecret verifies that the CS3 WOPI server accepts the IOP secret. The request carries
+// no file, so the server answers with an error, but only a rejected secret results in 401.
+func checkIOPSecret(ctx context.Context, client *http.Client, host, secret string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, host+"/wopi/iop/open", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Add("authorization", "Bearer "+secret)
+
+	rsp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+
+	switch {
+	case rsp.StatusCode == http.StatusUnauthorized:
+		return errors.New("IOP secret rejected")
+	case rsp.StatusCode >= http.StatusInternalServerError:
+		return fmt.Errorf("get /wopi/iop/open failed: status code %d", rsp.StatusCode)
+	}
+	return nil
+}
+
+// checkBreakers fails while the circuit of any WOPI host is open, as its calls fail right away.
+func checkBreakers(breakers *breaker.Set) error {
+	var open []string
+	for _, host := range breakers.Hosts() {
+		if breakers.Get(host).State() == breaker.Open {
+			open = append(open, host)
+		}
+	}
+	if len(open) > 0 {
+		return fmt.Errorf("circuit open for %s", strings.Join(open, ", "))
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package debug
 import (
 	"context"
 
+	"github.com/owncloud/ocis-wopiserver/pkg/breaker"
 	"github.com/owncloud/ocis-wopiserver/pkg/config"
 	"github.com/owncloud/ocis/ocis-pkg/log"
 )
@@ -12,10 +13,11 @@ type Option func(o *Options)
 
 // Options defines the available options for this package.
 type Options struct {
-	Name    string
-	Logger  log.Logger
-	Context context.Context
-	Config  *config.Config
+	Name     string
+	Logger   log.Logger
+	Context  context.Context
+	Config   *config.Config
+	Breakers *breaker.Set
 }
 
 // newOptions initializes the available default options.
@@ -56,3 +58,10 @@ func Config(val *config.Config) Option {
 		o.Config = val
 	}
 }
+
+// Breakers provides a function to set the circuit breakers of the WOPI hosts.
+func Breakers(val *breaker.Set) Option {
+	return func(o *Options) {
+		o.Breakers = val
+	}
+}
@@ -1,6 +1,7 @@
 package debug
 
 import (
+	"encoding/json"
 	"io"
 	"net/http"
 
@@ -22,7 +23,7 @@ func Server(opts ...Option) (*http.Server, error) {
 		debug.Pprof(options.Config.Debug.Pprof),
 		debug.Zpages(options.Config.Debug.Zpages),
 		debug.Health(health(options.Logger)),
-		debug.Ready(ready(options.Logger)),
+		debug.Ready(ready(options.Logger, checks(options.Config, options.Breakers))),
 	), nil
 }
 
@@ -32,7 +33,7 @@ func health(logger log.Logger) func(http.ResponseWriter, *http.Request) {
 		w.Header().Set("Content-Type", "text/plain")
 		w.WriteHeader(http.StatusOK)
 
-		// TODO(tboerger): check if services are up and running
+		// the service is alive as long as it answers, the dependencies are checked by ready
 
 		if _, err := io.WriteString(w, http.StatusText(http.StatusOK)); err != nil {
 			logger.Error().
@@ -43,15 +44,23 @@ func health(logger log.Logger) func(http.ResponseWriter, *http.Request) {
 	}
 }
 
-// ready implements the ready check.
-func ready(logger log.Logger) func(http.ResponseWriter, *http.Request) {
+// ready implements the ready check. It answers 503 if any dependency is unavailable.
+func ready(logger log.Logger, checks []check) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "text/plain")
-		w.WriteHeader(http.StatusOK)
+		result := runChecks(r.Context(), checks)
 
-		// TODO(tboerger): check if services are up and running
+		status := http.StatusOK
+		if result.Status != checkStatusOK {
+			status = http.StatusServiceUnavailable
+			logger.Warn().
+				Interface("checks", result.Checks).
+				Msg("Service is not ready")
+		}
 
-		if _, err := io.WriteString(w, http.StatusText(http.StatusOK)); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+
+		if err := json.NewEncoder(w).Encode(result); err != nil {
 			logger.Error().
 				Err(err).
 				Str("request", "ready").
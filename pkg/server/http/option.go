@@ -4,6 +4,8 @@ import (
 	"context"
 
 	"github.com/micro/cli/v2"
+	"github.com/owncloud/ocis-wopiserver/pkg/audit"
+	"github.com/owncloud/ocis-wopiserver/pkg/breaker"
 	"github.com/owncloud/ocis-wopiserver/pkg/config"
 	"github.com/owncloud/ocis-wopiserver/pkg/metrics"
 	"github.com/owncloud/ocis/ocis-pkg/log"
@@ -18,6 +20,8 @@ type Options struct {
 	Context   context.Context
 	Config    *config.Config
 	Metrics   *metrics.Metrics
+	Breakers  *breaker.Set
+	Audit     audit.Sink
 	Flags     []cli.Flag
 	Namespace string
 }
@@ -74,3 +78,17 @@ func Namespace(val string) Option {
 		o.Namespace = val
 	}
 }
+
+// Breakers provides a function to set the circuit breakers of the WOPI hosts.
+func Breakers(val *breaker.Set) Option {
+	return func(o *Options) {
+		o.Breakers = val
+	}
+}
+
+// Audit provides a function to set the audit sink option.
+func Audit(val audit.Sink) Option {
+	return func(o *Options) {
+		o.Audit = val
+	}
+}
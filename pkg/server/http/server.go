@@ -32,7 +32,11 @@ func Server(opts ...Option) (http.Service, error) {
 
 	handle := svc.NewService(
 		svc.Logger(options.Logger),
+		svc.Context(options.Context),
 		svc.Config(options.Config),
+		svc.Metrics(options.Metrics),
+		svc.Breakers(options.Breakers),
+		svc.Audit(options.Audit),
 		svc.Middleware(
 			middleware.RealIP,
 			middleware.RequestID,
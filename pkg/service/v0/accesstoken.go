@@ -0,0 +1,65 @@
+package svc
+
+import (
+	"errors"
+	"time"
+
+	appprovider "github.com/cs3org/go-cs3apis/cs3/app/provider/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/dgrijalva/jwt-go"
+)
+
+// accessTokenClaims are the claims of the access tokens handed to WOPI clients
+// by the built-in WOPI endpoints.
+type accessTokenClaims struct {
+	RevaToken string                                `json:"reva_token"`
+	StorageID string                                `json:"storage_id"`
+	OpaqueID  string                                `json:"opaque_id"`
+	ViewMode  appprovider.OpenInAppRequest_ViewMode `json:"view_mode"`
+	App       string                                `json:"app"`
+	UserID    string                                `json:"user_id"`
+	UserName  string                                `json:"user_name"`
+	// ResourceScoped is set if the reva token is limited to the file, see resourceToken
+	// and serviceContext.
+	ResourceScoped bool `json:"resource_scoped"`
+	jwt.StandardClaims
+}
+
+// canWrite reports whether the access token was issued for a read-write session.
+func (c accessTokenClaims) canWrite() bool {
+	return c.ViewMode == appprovider.OpenInAppRequest_VIEW_MODE_READ_WRITE
+}
+
+// resourceID returns the id of the resource the access token was issued for.
+func (c accessTokenClaims) resourceID() *provider.ResourceId {
+	return &provider.ResourceId{
+		StorageId: c.StorageID,
+		OpaqueId:  c.OpaqueID,
+	}
+}
+
+func mintAccessToken(claims accessTokenClaims, secret string, ttl time.Duration) (string, error) {
+	now := time.Now()
+	claims.IssuedAt = now.Unix()
+	claims.ExpiresAt = now.Add(ttl).Unix()
+
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+}
+
+func parseAccessToken(accessToken, secret string) (*accessTokenClaims, error) {
+	claims := &accessTokenClaims{}
+	t, err := jwt.ParseWithClaims(accessToken, claims, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+		return []byte(secret), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !t.Valid {
+		return nil, errors.New("invalid access token")
+	}
+
+	return claims, nil
+}
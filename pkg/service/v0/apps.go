@@ -0,0 +1,87 @@
+package svc
+
+import (
+	"context"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/owncloud/ocis-wopiserver/pkg/config"
+	"github.com/owncloud/ocis-wopiserver/pkg/metrics"
+	"github.com/owncloud/ocis/ocis-pkg/log"
+)
+
+// wopiApp is a configured WOPI app together with its cached discovery.
+type wopiApp struct {
+	config.WopiApp
+	discovery *discoveryCache
+}
+
+// newWopiApps returns the configured WOPI apps ordered by priority, or the app at AppHost if none are configured.
+func newWopiApps(cfg config.WopiServer, fetch func(context.Context, string) (*wopiDiscovery, error), logger log.Logger, m *metrics.Metrics) []*wopiApp {
+	configured := cfg.WopiApps()
+
+	apps := make([]*wopiApp, 0, len(configured))
+	for _, c := range configured {
+		apps = append(apps, &wopiApp{
+			WopiApp:   c,
+			discovery: newDiscoveryCache(c.Host, cfg.DiscoveryTTL, fetch, logger, m),
+		})
+	}
+	sort.SliceStable(apps, func(i, j int) bool { return apps[i].Priority > apps[j].Priority })
+
+	return apps
+}
+
+// handles reports whether the app may open files with the extension.
+func (a *wopiApp) handles(ext string) bool {
+	if containsExtension(a.DisabledExtensions, ext) {
+		return false
+	}
+	return len(a.Extensions) == 0 || containsExtension(a.Extensions, ext)
+}
+
+// extensions returns the extension to handler table of the app.
+func (a *wopiApp) extensions(ctx context.Context) (map[string]ExtensionHandler, error) {
+	appURL, err := url.Parse(a.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	discovery, err := a.discovery.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	extensions := discovery.extensions(appURL.Scheme)
+	for ext, handler := range extensions {
+		if !a.handles(ext) {
+			delete(extensions, ext)
+			continue
+		}
+		handler.App = a.Name
+		extensions[ext] = handler
+	}
+
+	return extensions, nil
+}
+
+// containsExtension reports whether the list contains the extension, with or without the leading dot.
+func containsExtension(list []string, ext string) bool {
+	for _, e := range list {
+		if "."+strings.TrimPrefix(strings.ToLower(e), ".") == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// selectHandler returns the handler of the named app, or the one of the app with the highest priority.
+func selectHandler(handlers []ExtensionHandler, app string) (ExtensionHandler, bool) {
+	for _, h := range handlers {
+		if app == "" || h.App == app {
+			return h, true
+		}
+	}
+	return ExtensionHandler{}, false
+}
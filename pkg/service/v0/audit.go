@@ -0,0 +1,33 @@
+package svc
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/owncloud/ocis-wopiserver/pkg/audit"
+)
+
+// audit writes the audit event of the request, completed with the time, the client IP and the request ID.
+// The WOPI endpoints are called by the WOPI app, so their client IP is the one of the app.
+func (p WopiServer) audit(r *http.Request, e audit.Event) {
+	if p.auditSink == nil {
+		return
+	}
+
+	e.Time = time.Now()
+	e.ClientIP = clientIP(r)
+	e.RequestID = middleware.GetReqID(r.Context())
+	if err := p.auditSink.Write(e); err != nil {
+		p.logger.Error().Err(err).Str("action", string(e.Action)).Str("fileid", e.FileID).Msg("could not write audit event")
+	}
+}
+
+// clientIP returns the IP of the client, which the RealIP middleware takes from the proxy headers.
+func clientIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
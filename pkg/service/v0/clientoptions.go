@@ -0,0 +1,70 @@
+package svc
+
+import (
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+)
+
+// wopiClientOptions returns the options added to the WOPI client URL. The configured defaults
+// are overridden by the query or form parameters of the same name: lang, closebutton, revisionhistory and title.
+func (p WopiServer) wopiClientOptions(r *http.Request, info *provider.ResourceInfo) url.Values {
+	cfg := p.config.WopiClient
+	options := url.Values{}
+
+	if lang := firstNonEmpty(r.FormValue("lang"), acceptLanguage(r.Header.Get("Accept-Language")), cfg.Lang); lang != "" {
+		options.Set("lang", lang)
+	}
+	if boolOption(r.FormValue("closebutton"), cfg.CloseButton) {
+		options.Set("closebutton", "1")
+	}
+	if boolOption(r.FormValue("revisionhistory"), cfg.RevisionHistory) {
+		options.Set("revisionhistory", "1")
+	}
+	if title := firstNonEmpty(r.FormValue("title"), filepath.Base(info.GetPath())); title != "" && title != "." {
+		options.Set("title", title)
+	}
+	if cfg.UIDefaults != "" {
+		options.Set("ui_defaults", cfg.UIDefaults)
+	}
+
+	return options
+}
+
+// acceptLanguage returns the preferred language of an Accept-Language header,
+// e.g. "de-DE" for "de-DE,de;q=0.9,en;q=0.8".
+func acceptLanguage(header string) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		lang := strings.TrimSpace(fields[0])
+		if lang == "" || lang == "*" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if q > bestQ {
+			best, bestQ = lang, q
+		}
+	}
+	return best
+}
+
+// boolOption returns the value of a boolean query parameter or the default if it is not set or invalid.
+func boolOption(value string, def bool) bool {
+	if b, err := strconv.ParseBool(value); err == nil {
+		return b
+	}
+	return def
+}
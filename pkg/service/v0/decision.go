@@ -0,0 +1,79 @@
+package svc
+
+import (
+	appprovider "github.com/cs3org/go-cs3apis/cs3/app/provider/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+)
+
+// openOutcome is the way a file is opened in the WOPI app.
+type openOutcome int
+
+const (
+	outcomeForbidden openOutcome = iota
+	outcomeViewOnly
+	outcomeView
+	outcomeEdit
+)
+
+func (o openOutcome) String() string {
+	switch o {
+	case outcomeViewOnly:
+		return "view-only"
+	case outcomeView:
+		return "view"
+	case outcomeEdit:
+		return "edit"
+	default:
+		return "forbidden"
+	}
+}
+
+// openDecision is the outcome of deciding how a file is opened, together with the view mode
+// and the handler URL to use. The reason explains why a file is forbidden or opened with
+// less than the requested view mode.
+type openDecision struct {
+	Outcome openOutcome
+	Mode    appprovider.OpenInAppRequest_ViewMode
+	URL     string
+	Reason  string
+}
+
+func forbidden(reason string) openDecision {
+	return openDecision{Outcome: outcomeForbidden, Reason: reason}
+}
+
+// decideOpen decides how the file is opened with the handler, based on the requested view mode,
+// the permissions of the user and the actions the WOPI app offers.
+func decideOpen(requested appprovider.OpenInAppRequest_ViewMode, info *provider.ResourceInfo, handler ExtensionHandler) openDecision {
+	allowed := maxViewMode(info.PermissionSet)
+	if allowed == appprovider.OpenInAppRequest_VIEW_MODE_INVALID {
+		return forbidden("no permission to view the file")
+	}
+
+	mode := viewMode(requested, info.PermissionSet)
+	reason := ""
+	if requested != appprovider.OpenInAppRequest_VIEW_MODE_INVALID && mode < requested {
+		reason = "no permission to open the file in " + requested.String()
+	}
+	if mode == appprovider.OpenInAppRequest_VIEW_MODE_READ_WRITE && handler.EditURL == "" {
+		mode = appprovider.OpenInAppRequest_VIEW_MODE_READ_ONLY
+		reason = "app cannot edit the file type"
+	}
+
+	isEmpty := info.Size == 0
+	switch {
+	case mode == appprovider.OpenInAppRequest_VIEW_MODE_READ_WRITE && isEmpty:
+		// let the WOPI client do the file initialization
+		return openDecision{Outcome: outcomeEdit, Mode: mode, URL: handler.NewURL, Reason: reason}
+	case mode == appprovider.OpenInAppRequest_VIEW_MODE_READ_WRITE:
+		return openDecision{Outcome: outcomeEdit, Mode: mode, URL: handler.EditURL, Reason: reason}
+	case isEmpty:
+		return forbidden("file is empty and read-only")
+	case handler.ViewURL == "":
+		return forbidden("app cannot view the file type")
+	case mode == appprovider.OpenInAppRequest_VIEW_MODE_VIEW_ONLY:
+		return openDecision{Outcome: outcomeViewOnly, Mode: mode, URL: handler.ViewURL, Reason: reason}
+	default:
+		return openDecision{Outcome: outcomeView, Mode: mode, URL: handler.ViewURL, Reason: reason}
+	}
+}
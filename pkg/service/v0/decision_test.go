@@ -0,0 +1,107 @@
+package svc
+
+import (
+	"testing"
+
+	appprovider "github.com/cs3org/go-cs3apis/cs3/app/provider/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+)
+
+const (
+	modeNone      = appprovider.OpenInAppRequest_VIEW_MODE_INVALID
+	modeViewOnly  = appprovider.OpenInAppRequest_VIEW_MODE_VIEW_ONLY
+	modeReadOnly  = appprovider.OpenInAppRequest_VIEW_MODE_READ_ONLY
+	modeReadWrite = appprovider.OpenInAppRequest_VIEW_MODE_READ_WRITE
+)
+
+var (
+	permsStat      = &provider.ResourcePermissions{Stat: true}
+	permsDownload  = &provider.ResourcePermissions{Stat: true, InitiateFileDownload: true}
+	permsReadWrite = &provider.ResourcePermissions{Stat: true, InitiateFileDownload: true, InitiateFileUpload: true}
+
+	fullHandler = ExtensionHandler{ViewURL: "view", EditURL: "edit", NewURL: "new"}
+)
+
+func TestDecideOpen(t *testing.T) {
+	tests := []struct {
+		name      string
+		requested appprovider.OpenInAppRequest_ViewMode
+		perms     *provider.ResourcePermissions
+		size      uint64
+		handler   ExtensionHandler
+		want      openDecision
+	}{
+		{"no permissions", modeNone, nil, 3, fullHandler, forbidden("no permission to view the file")},
+		{"no permissions, read-write requested", modeReadWrite, nil, 3, fullHandler, forbidden("no permission to view the file")},
+		{"empty permissions", modeViewOnly, &provider.ResourcePermissions{}, 3, fullHandler, forbidden("no permission to view the file")},
+
+		{"stat, nothing requested", modeNone, permsStat, 3, fullHandler, openDecision{outcomeViewOnly, modeViewOnly, "view", ""}},
+		{"stat, view-only requested", modeViewOnly, permsStat, 3, fullHandler, openDecision{outcomeViewOnly, modeViewOnly, "view", ""}},
+		{"stat, read-only requested", modeReadOnly, permsStat, 3, fullHandler, openDecision{outcomeViewOnly, modeViewOnly, "view", "no permission to open the file in VIEW_MODE_READ_ONLY"}},
+		{"stat, read-write requested", modeReadWrite, permsStat, 3, fullHandler, openDecision{outcomeViewOnly, modeViewOnly, "view", "no permission to open the file in VIEW_MODE_READ_WRITE"}},
+
+		{"download, nothing requested", modeNone, permsDownload, 3, fullHandler, openDecision{outcomeView, modeReadOnly, "view", ""}},
+		{"download, view-only requested", modeViewOnly, permsDownload, 3, fullHandler, openDecision{outcomeViewOnly, modeViewOnly, "view", ""}},
+		{"download, read-only requested", modeReadOnly, permsDownload, 3, fullHandler, openDecision{outcomeView, modeReadOnly, "view", ""}},
+		{"download, read-write requested", modeReadWrite, permsDownload, 3, fullHandler, openDecision{outcomeView, modeReadOnly, "view", "no permission to open the file in VIEW_MODE_READ_WRITE"}},
+
+		{"read-write, nothing requested", modeNone, permsReadWrite, 3, fullHandler, openDecision{outcomeEdit, modeReadWrite, "edit", ""}},
+		{"read-write, view-only requested", modeViewOnly, permsReadWrite, 3, fullHandler, openDecision{outcomeViewOnly, modeViewOnly, "view", ""}},
+		{"read-write, read-only requested", modeReadOnly, permsReadWrite, 3, fullHandler, openDecision{outcomeView, modeReadOnly, "view", ""}},
+		{"read-write, read-write requested", modeReadWrite, permsReadWrite, 3, fullHandler, openDecision{outcomeEdit, modeReadWrite, "edit", ""}},
+
+		{"empty file, read-write", modeNone, permsReadWrite, 0, fullHandler, openDecision{outcomeEdit, modeReadWrite, "new", ""}},
+		{"empty file, read-only requested", modeReadOnly, permsReadWrite, 0, fullHandler, forbidden("file is empty and read-only")},
+		{"empty file, download", modeNone, permsDownload, 0, fullHandler, forbidden("file is empty and read-only")},
+		{"empty file, stat", modeNone, permsStat, 0, fullHandler, forbidden("file is empty and read-only")},
+
+		{"no edit URL", modeNone, permsReadWrite, 3, ExtensionHandler{ViewURL: "view"}, openDecision{outcomeView, modeReadOnly, "view", "app cannot edit the file type"}},
+		{"no edit URL, read-write requested", modeReadWrite, permsReadWrite, 3, ExtensionHandler{ViewURL: "view"}, openDecision{outcomeView, modeReadOnly, "view", "app cannot edit the file type"}},
+		{"no view URL, read-write", modeNone, permsReadWrite, 3, ExtensionHandler{EditURL: "edit"}, openDecision{outcomeEdit, modeReadWrite, "edit", ""}},
+		{"no view URL, download", modeNone, permsDownload, 3, ExtensionHandler{EditURL: "edit"}, forbidden("app cannot view the file type")},
+		{"no view URL, stat", modeNone, permsStat, 3, ExtensionHandler{EditURL: "edit"}, forbidden("app cannot view the file type")},
+		{"no URLs", modeNone, permsReadWrite, 3, ExtensionHandler{}, forbidden("app cannot view the file type")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := decideOpen(tt.requested, &provider.ResourceInfo{Size: tt.size, PermissionSet: tt.perms}, tt.handler)
+			if got != tt.want {
+				t.Errorf("decideOpen() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestDecideOpenNeverExceedsPermissions checks every combination against the rule that
+// a user never gets a higher view mode than the permissions allow.
+func TestDecideOpenNeverExceedsPermissions(t *testing.T) {
+	modes := []appprovider.OpenInAppRequest_ViewMode{modeNone, modeViewOnly, modeReadOnly, modeReadWrite}
+	perms := map[string]*provider.ResourcePermissions{
+		"nil": nil, "empty": {}, "stat": permsStat, "download": permsDownload, "read-write": permsReadWrite,
+		"upload only": {Stat: true, InitiateFileUpload: true},
+	}
+	handlers := []ExtensionHandler{fullHandler, {ViewURL: "view"}, {EditURL: "edit"}, {}}
+
+	for name, p := range perms {
+		allowed := map[string]openOutcome{
+			"nil": outcomeForbidden, "empty": outcomeForbidden, "stat": outcomeViewOnly,
+			"download": outcomeView, "read-write": outcomeEdit, "upload only": outcomeViewOnly,
+		}[name]
+		for _, requested := range modes {
+			for _, h := range handlers {
+				for _, size := range []uint64{0, 3} {
+					d := decideOpen(requested, &provider.ResourceInfo{Size: size, PermissionSet: p}, h)
+					if d.Outcome > allowed || d.Mode > maxViewMode(p) {
+						t.Errorf("%s permissions, %s requested, handler %+v, size %d: got %+v", name, requested, h, size, d)
+					}
+					if requested != modeNone && d.Mode > requested {
+						t.Errorf("%s permissions, %s requested, handler %+v, size %d: got more than requested: %+v", name, requested, h, size, d)
+					}
+					if d.Outcome == outcomeForbidden && d.Reason == "" {
+						t.Errorf("%s permissions, %s requested: forbidden without a reason", name, requested)
+					}
+				}
+			}
+		}
+	}
+}
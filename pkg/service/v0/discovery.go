@@ -0,0 +1,148 @@
+package svc
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// wopiDiscovery is the discovery document a WOPI app publishes on /hosting/discovery.
+// https://wopi.readthedocs.io/en/latest/discovery.html
+type wopiDiscovery struct {
+	XMLName  xml.Name          `xml:"wopi-discovery"`
+	NetZones []discoveryZone   `xml:"net-zone"`
+	ProofKey discoveryProofKey `xml:"proof-key"`
+}
+
+type discoveryZone struct {
+	Name string         `xml:"name,attr"`
+	Apps []discoveryApp `xml:"app"`
+}
+
+type discoveryApp struct {
+	Name       string            `xml:"name,attr"`
+	FavIconURL string            `xml:"favIconUrl,attr"`
+	Actions    []discoveryAction `xml:"action"`
+}
+
+type discoveryAction struct {
+	Name   string `xml:"name,attr"`
+	Ext    string `xml:"ext,attr"`
+	URLSrc string `xml:"urlsrc,attr"`
+}
+
+// placeholderPattern matches the optional query parameters of an urlsrc, e.g. "<ui=UI_LLCC&>".
+var placeholderPattern = regexp.MustCompile(`<([^=<>]+)=([^&<>]+)&?>`)
+
+// substituteURLSrc replaces the placeholders of an urlsrc with the given values
+// and drops the placeholders without a value.
+func substituteURLSrc(urlsrc string, values map[string]string) string {
+	return placeholderPattern.ReplaceAllStringFunc(urlsrc, func(placeholder string) string {
+		m := placeholderPattern.FindStringSubmatch(placeholder)
+		if v, ok := values[m[2]]; ok && v != "" {
+			return m[1] + "=" + url.QueryEscape(v) + "&"
+		}
+		return ""
+	})
+}
+
+// getDiscovery fetches and parses the discovery document of the WOPI app at host.
+func (p WopiServer) getDiscovery(ctx context.Context, host string) (*wopiDiscovery, error) {
+	ctx, cancel := withTimeout(ctx, p.config.WopiServer.DiscoveryTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(host, "/")+"/hosting/discovery", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	r, err := p.hostClient.Do(req)
+	p.observeUpstream(upstreamDiscovery, start, err != nil || r.StatusCode != http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+
+	if r.StatusCode != http.StatusOK {
+		return nil, errors.New("get /hosting/discovery failed: status code != 200")
+	}
+
+	d := &wopiDiscovery{}
+	if err := xml.NewDecoder(r.Body).Decode(d); err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// extensions builds the extension to handler table from the discovery. The net zones
+// matching the scheme of the WOPI app are preferred and external zones win over internal ones.
+// The placeholders of the urlsrc are kept and substituted when the WOPI client URL is built.
+func (d *wopiDiscovery) extensions(scheme string) map[string]ExtensionHandler {
+	zones := make([]discoveryZone, len(d.NetZones))
+	copy(zones, d.NetZones)
+	rank := func(z discoveryZone) int {
+		r := 0
+		if !strings.HasSuffix(z.Name, "-"+scheme) {
+			r += 2
+		}
+		if !strings.HasPrefix(z.Name, "external-") {
+			r++
+		}
+		return r
+	}
+	sort.SliceStable(zones, func(i, j int) bool { return rank(zones[i]) < rank(zones[j]) })
+
+	actions := map[string]map[string]string{}
+	icons := map[string]string{}
+	for _, zone := range zones {
+		for _, app := range zone.Apps {
+			for _, action := range app.Actions {
+				if action.Ext == "" || action.URLSrc == "" {
+					continue
+				}
+				ext := "." + strings.ToLower(action.Ext)
+				if actions[ext] == nil {
+					actions[ext] = map[string]string{}
+					icons[ext] = app.FavIconURL
+				}
+				if _, ok := actions[ext][action.Name]; !ok {
+					actions[ext][action.Name] = action.URLSrc
+				}
+			}
+		}
+	}
+
+	extensions := map[string]ExtensionHandler{}
+	for ext, a := range actions {
+		handler := ExtensionHandler{
+			ViewURL:    firstNonEmpty(a["view"], a["edit"]),
+			EditURL:    a["edit"],
+			NewURL:     firstNonEmpty(a["editnew"], a["edit"]),
+			ConvertURL: a["convert"],
+			IconURL:    icons[ext],
+		}
+		if handler.ViewURL == "" && handler.EditURL == "" {
+			continue
+		}
+		extensions[ext] = handler
+	}
+
+	return extensions
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,142 @@
+package svc
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/owncloud/ocis-wopiserver/pkg/metrics"
+	"github.com/owncloud/ocis/ocis-pkg/log"
+)
+
+// discoveryCache keeps the last successfully fetched WOPI discovery of a WOPI app.
+type discoveryCache struct {
+	host    string
+	ttl     time.Duration
+	fetch   func(ctx context.Context, host string) (*wopiDiscovery, error)
+	logger  log.Logger
+	metrics *metrics.Metrics
+
+	mu        sync.RWMutex
+	discovery *wopiDiscovery
+	fetchedAt time.Time
+	// background is set while run refreshes the discovery.
+	background bool
+	// inflight is the running fetch, which concurrent refreshes wait for.
+	inflight *discoveryFetch
+}
+
+// discoveryFetch is a fetch of the discovery shared by concurrent refreshes.
+type discoveryFetch struct {
+	done      chan struct{}
+	discovery *wopiDiscovery
+	err       error
+}
+
+func newDiscoveryCache(host string, ttl time.Duration, fetch func(context.Context, string) (*wopiDiscovery, error), logger log.Logger, m *metrics.Metrics) *discoveryCache {
+	return &discoveryCache{
+		host:    host,
+		ttl:     ttl,
+		fetch:   fetch,
+		logger:  logger,
+		metrics: m,
+	}
+}
+
+// get returns the cached discovery. While run refreshes it in the background, the cached
+// discovery is served as it is and only fetched if there is none yet. Otherwise it is fetched
+// if it is missing or older than the TTL, and the last good discovery is served if that fails.
+func (c *discoveryCache) get(ctx context.Context) (*wopiDiscovery, error) {
+	c.mu.RLock()
+	d, fetchedAt, background := c.discovery, c.fetchedAt, c.background
+	c.mu.RUnlock()
+
+	if d != nil && (background || time.Since(fetchedAt) < c.ttl) {
+		return d, nil
+	}
+
+	fresh, err := c.refresh(ctx)
+	if err != nil {
+		if d != nil {
+			c.logger.Warn().Err(err).Str("host", c.host).Time("fetched", fetchedAt).Msg("could not refresh WOPI discovery, serving the cached one")
+			return d, nil
+		}
+		return nil, err
+	}
+
+	return fresh, nil
+}
+
+// refresh fetches the discovery and replaces the cached one on success. Concurrent refreshes
+// share a single fetch.
+func (c *discoveryCache) refresh(ctx context.Context) (*wopiDiscovery, error) {
+	c.mu.Lock()
+	if f := c.inflight; f != nil {
+		c.mu.Unlock()
+		select {
+		case <-f.done:
+			return f.discovery, f.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	f := &discoveryFetch{done: make(chan struct{})}
+	c.inflight = f
+	c.mu.Unlock()
+
+	f.discovery, f.err = c.fetch(ctx, c.host)
+
+	now := time.Now()
+	c.mu.Lock()
+	c.inflight = nil
+	if f.err == nil {
+		c.discovery, c.fetchedAt = f.discovery, now
+	}
+	c.mu.Unlock()
+	close(f.done)
+
+	if f.err != nil {
+		return nil, f.err
+	}
+	c.observeFetched(now)
+	return f.discovery, nil
+}
+
+// run refreshes the discovery every TTL until the context is done.
+func (c *discoveryCache) run(ctx context.Context) {
+	c.mu.Lock()
+	c.background = true
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		c.background = false
+		c.mu.Unlock()
+	}()
+
+	if _, err := c.refresh(ctx); err != nil {
+		c.logger.Warn().Err(err).Str("host", c.host).Msg("could not fetch WOPI discovery")
+	}
+
+	ticker := time.NewTicker(c.ttl)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := c.refresh(ctx); err != nil {
+				c.logger.Warn().Err(err).Str("host", c.host).Msg("could not refresh WOPI discovery")
+			}
+		}
+	}
+}
+
+// observeFetched exports the time the discovery was fetched, its age is computed when the
+// metric is queried rather than when it was last set.
+func (c *discoveryCache) observeFetched(fetchedAt time.Time) {
+	if c.metrics == nil {
+		return
+	}
+	c.metrics.DiscoveryFetched.WithLabelValues(c.host).Set(float64(fetchedAt.Unix()))
+}
@@ -0,0 +1,86 @@
+package svc
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/owncloud/ocis/ocis-pkg/log"
+)
+
+func TestDiscoveryCacheGet(t *testing.T) {
+	cached := &wopiDiscovery{}
+	fetched := &wopiDiscovery{}
+
+	tests := []struct {
+		name       string
+		fetchedAt  time.Time
+		background bool
+		fetchErr   error
+		want       *wopiDiscovery
+		wantFetch  bool
+	}{
+		{"fresh", time.Now(), false, nil, cached, false},
+		{"stale", time.Now().Add(-2 * time.Hour), false, nil, fetched, true},
+		{"stale, fetch fails", time.Now().Add(-2 * time.Hour), false, errors.New("down"), cached, true},
+		{"stale, refreshed in the background", time.Now().Add(-2 * time.Hour), true, nil, cached, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fetches := 0
+			fetch := func(context.Context, string) (*wopiDiscovery, error) {
+				fetches++
+				if tt.fetchErr != nil {
+					return nil, tt.fetchErr
+				}
+				return fetched, nil
+			}
+			c := newDiscoveryCache("app", time.Hour, fetch, log.NewLogger(), nil)
+			c.discovery, c.fetchedAt, c.background = cached, tt.fetchedAt, tt.background
+
+			got, err := c.get(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("get() returned the wrong discovery")
+			}
+			if (fetches > 0) != tt.wantFetch {
+				t.Errorf("get() fetched %d times, want fetch %v", fetches, tt.wantFetch)
+			}
+		})
+	}
+}
+
+func TestDiscoveryCacheSharesFetches(t *testing.T) {
+	var fetches int32
+	release := make(chan struct{})
+	fetch := func(context.Context, string) (*wopiDiscovery, error) {
+		atomic.AddInt32(&fetches, 1)
+		<-release
+		return &wopiDiscovery{}, nil
+	}
+	c := newDiscoveryCache("app", time.Hour, fetch, log.NewLogger(), nil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.get(context.Background()); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	// let the requests pile up behind the first fetch
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&fetches); n != 1 {
+		t.Errorf("concurrent requests fetched the discovery %d times, want 1", n)
+	}
+}
@@ -0,0 +1,158 @@
+package svc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	merrors "github.com/asim/go-micro/v3/errors"
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	"github.com/go-chi/chi/middleware"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Error codes of the API error responses.
+const (
+	ErrorCodeBadRequest          = "BAD_REQUEST"
+	ErrorCodeUnauthenticated     = "UNAUTHENTICATED"
+	ErrorCodeForbidden           = "FORBIDDEN"
+	ErrorCodeNotFound            = "NOT_FOUND"
+	ErrorCodeConflict            = "CONFLICT"
+	ErrorCodeUnsupportedFileType = "UNSUPPORTED_FILE_TYPE"
+	ErrorCodeInternal            = "INTERNAL_ERROR"
+	ErrorCodeBadGateway          = "BAD_GATEWAY"
+	ErrorCodeGatewayTimeout      = "GATEWAY_TIMEOUT"
+)
+
+// errorCodes maps the HTTP status of an API error to its error code.
+var errorCodes = map[int]string{
+	http.StatusBadRequest:           ErrorCodeBadRequest,
+	http.StatusUnauthorized:         ErrorCodeUnauthenticated,
+	http.StatusForbidden:            ErrorCodeForbidden,
+	http.StatusNotFound:             ErrorCodeNotFound,
+	http.StatusConflict:             ErrorCodeConflict,
+	http.StatusUnsupportedMediaType: ErrorCodeUnsupportedFileType,
+	http.StatusInternalServerError:  ErrorCodeInternal,
+	http.StatusBadGateway:           ErrorCodeBadGateway,
+	http.StatusGatewayTimeout:       ErrorCodeGatewayTimeout,
+}
+
+// ErrorResponse is the body of failed API requests.
+type ErrorResponse struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	RequestID string `json:"requestid,omitempty"`
+}
+
+// errUnauthenticated is returned if a request carries neither a user nor a public share token.
+var errUnauthenticated = errors.New("unauthenticated request")
+
+// apiStatus maps an error to the HTTP status of the API response. go-micro errors keep their
+// code, timeouts become 504 and all other errors are internal server errors.
+func apiStatus(err error) int {
+	var e *merrors.Error
+	if !errors.As(err, &e) {
+		return http.StatusInternalServerError
+	}
+	switch code := int(e.Code); code {
+	case http.StatusRequestTimeout:
+		return http.StatusGatewayTimeout
+	case http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound,
+		http.StatusConflict, http.StatusUnsupportedMediaType, http.StatusBadGateway, http.StatusGatewayTimeout:
+		return code
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// writeError writes the JSON error response of an API request and logs the error.
+func (p WopiServer) writeError(w http.ResponseWriter, r *http.Request, err error) {
+	code := apiStatus(err)
+
+	message := err.Error()
+	var e *merrors.Error
+	if errors.As(err, &e) {
+		message = e.Detail
+	}
+
+	requestID := middleware.GetReqID(r.Context())
+	switch {
+	case r.Context().Err() != nil:
+		// the client went away and stopped the upstream calls
+		p.logger.Debug().Err(err).Str("request", requestID).Str("path", r.URL.Path).Msg("request canceled")
+	case code >= http.StatusInternalServerError:
+		p.logger.Error().Err(err).Str("request", requestID).Str("path", r.URL.Path).Msg("request failed")
+	default:
+		p.logger.Debug().Err(err).Str("request", requestID).Str("path", r.URL.Path).Msg("request failed")
+	}
+
+	js, _ := json.Marshal(ErrorResponse{
+		Code:      errorCodes[code],
+		Message:   message,
+		RequestID: requestID,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(js)
+}
+
+// upstreamError wraps an error of a call to the gateway or a WOPI app: 504 if the call timed out, 502 otherwise.
+func (p WopiServer) upstreamError(err error, action string) error {
+	if errors.Is(err, context.DeadlineExceeded) || status.Code(err) == codes.DeadlineExceeded {
+		return merrors.New(p.serviceID, action+": "+err.Error(), http.StatusGatewayTimeout)
+	}
+	return merrors.New(p.serviceID, action+": "+err.Error(), http.StatusBadGateway)
+}
+
+// cs3StatusError maps a failed CS3 status to an error.
+func (p WopiServer) cs3StatusError(s *rpc.Status, action string) error {
+	switch s.Code {
+	case rpc.Code_CODE_NOT_FOUND:
+		return merrors.NotFound(p.serviceID, "%s: %s", action, s.Message)
+	case rpc.Code_CODE_PERMISSION_DENIED:
+		return merrors.Forbidden(p.serviceID, "%s: %s", action, s.Message)
+	case rpc.Code_CODE_UNAUTHENTICATED:
+		return merrors.Unauthorized(p.serviceID, "%s: %s", action, s.Message)
+	case rpc.Code_CODE_DEADLINE_EXCEEDED:
+		return merrors.New(p.serviceID, action+": "+s.Message, http.StatusGatewayTimeout)
+	default:
+		return merrors.New(p.serviceID, action+": "+s.Message, http.StatusBadGateway)
+	}
+}
+
+// cs3StatusErr carries a failed CS3 status out of the helpers calling the gateway, so that
+// callers can map it with gatewayError.
+type cs3StatusErr struct {
+	status *rpc.Status
+}
+
+func (e cs3StatusErr) Error() string {
+	return e.status.GetMessage()
+}
+
+// gatewayError maps an error of a helper calling the gateway: failed CS3 statuses like
+// cs3StatusError, all other errors like upstreamError.
+func (p WopiServer) gatewayError(err error, action string) error {
+	var e cs3StatusErr
+	if errors.As(err, &e) {
+		return p.cs3StatusError(e.status, action)
+	}
+	return p.upstreamError(err, action)
+}
+
+// cs3Failed reports whether a CS3 call failed, as opposed to answering that the resource
+// is missing or not accessible.
+func cs3Failed(s *rpc.Status, err error) bool {
+	if err != nil {
+		return true
+	}
+	switch s.GetCode() {
+	case rpc.Code_CODE_OK, rpc.Code_CODE_NOT_FOUND, rpc.Code_CODE_PERMISSION_DENIED, rpc.Code_CODE_UNAUTHENTICATED:
+		return false
+	default:
+		return true
+	}
+}
@@ -0,0 +1,66 @@
+package svc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	merrors "github.com/asim/go-micro/v3/errors"
+	gateway "github.com/cs3org/go-cs3apis/cs3/gateway/v1beta1"
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"google.golang.org/grpc"
+)
+
+// statGateway answers every stat with the same status or error.
+type statGateway struct {
+	gateway.GatewayAPIClient
+	code rpc.Code
+	err  error
+}
+
+func (g statGateway) Stat(ctx context.Context, in *provider.StatRequest, opts ...grpc.CallOption) (*provider.StatResponse, error) {
+	if g.err != nil {
+		return nil, g.err
+	}
+	return &provider.StatResponse{
+		Status: &rpc.Status{Code: g.code, Message: g.code.String()},
+		Info:   &provider.ResourceInfo{Path: in.Ref.GetPath()},
+	}, nil
+}
+
+func TestUniquePathErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		gateway  statGateway
+		wantCode int
+	}{
+		{"permission denied", statGateway{code: rpc.Code_CODE_PERMISSION_DENIED}, http.StatusForbidden},
+		{"unauthenticated", statGateway{code: rpc.Code_CODE_UNAUTHENTICATED}, http.StatusUnauthorized},
+		{"gateway failure", statGateway{code: rpc.Code_CODE_INTERNAL}, http.StatusBadGateway},
+		{"gateway timeout", statGateway{err: context.DeadlineExceeded}, http.StatusGatewayTimeout},
+		{"unreachable gateway", statGateway{err: errors.New("connection refused")}, http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := WopiServer{client: tt.gateway}
+
+			_, err := p.uniquePath(context.Background(), "/home", "new.odt")
+			if err == nil || errors.Is(err, errNoFreeFileName) {
+				t.Fatalf("uniquePath() error = %v, want a gateway error", err)
+			}
+			var e *merrors.Error
+			if !errors.As(p.gatewayError(err, "stat"), &e) || int(e.Code) != tt.wantCode {
+				t.Errorf("gatewayError() = %v, want code %d", e, tt.wantCode)
+			}
+		})
+	}
+
+	t.Run("all names taken", func(t *testing.T) {
+		p := WopiServer{client: statGateway{code: rpc.Code_CODE_OK}}
+		if _, err := p.uniquePath(context.Background(), "/home", "new.odt"); !errors.Is(err, errNoFreeFileName) {
+			t.Errorf("uniquePath() error = %v, want %v", err, errNoFreeFileName)
+		}
+	})
+}
@@ -0,0 +1,177 @@
+package svc
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+)
+
+// officeMimeTypes are the MIME types of office formats, which are often missing from the system MIME table.
+var officeMimeTypes = map[string]string{
+	".odt":  "application/vnd.oasis.opendocument.text",
+	".ott":  "application/vnd.oasis.opendocument.text-template",
+	".fodt": "application/vnd.oasis.opendocument.text-flat-xml",
+	".ods":  "application/vnd.oasis.opendocument.spreadsheet",
+	".ots":  "application/vnd.oasis.opendocument.spreadsheet-template",
+	".fods": "application/vnd.oasis.opendocument.spreadsheet-flat-xml",
+	".odp":  "application/vnd.oasis.opendocument.presentation",
+	".otp":  "application/vnd.oasis.opendocument.presentation-template",
+	".fodp": "application/vnd.oasis.opendocument.presentation-flat-xml",
+	".odg":  "application/vnd.oasis.opendocument.graphics",
+	".doc":  "application/msword",
+	".docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	".docm": "application/vnd.ms-word.document.macroEnabled.12",
+	".dotx": "application/vnd.openxmlformats-officedocument.wordprocessingml.template",
+	".xls":  "application/vnd.ms-excel",
+	".xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	".xlsm": "application/vnd.ms-excel.sheet.macroEnabled.12",
+	".xltx": "application/vnd.openxmlformats-officedocument.spreadsheetml.template",
+	".ppt":  "application/vnd.ms-powerpoint",
+	".pptx": "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+	".pptm": "application/vnd.ms-powerpoint.presentation.macroEnabled.12",
+	".potx": "application/vnd.openxmlformats-officedocument.presentationml.template",
+	".rtf":  "application/rtf",
+	".csv":  "text/csv",
+	".txt":  "text/plain",
+	".pdf":  "application/pdf",
+}
+
+// mimeTypeByExtension returns the MIME type of an extension without parameters, or "" if it is unknown.
+func mimeTypeByExtension(ext string) string {
+	ext = strings.ToLower(ext)
+	if t, ok := officeMimeTypes[ext]; ok {
+		return t
+	}
+	t, _, err := mime.ParseMediaType(mime.TypeByExtension(ext))
+	if err != nil {
+		return ""
+	}
+	return t
+}
+
+// extensionsByMimeType returns the extensions of a MIME type: the configured alias first,
+// then the known office extensions and the extensions of the system MIME table.
+func (p WopiServer) extensionsByMimeType(mimeType string) []string {
+	if t, _, err := mime.ParseMediaType(mimeType); err == nil {
+		mimeType = t
+	}
+	mimeType = strings.ToLower(mimeType)
+
+	var exts []string
+	for alias, ext := range p.config.WopiServer.MimeTypeAliases {
+		if strings.ToLower(alias) == mimeType {
+			exts = append(exts, "."+strings.TrimPrefix(strings.ToLower(ext), "."))
+		}
+	}
+
+	var known []string
+	for ext, t := range officeMimeTypes {
+		if strings.ToLower(t) == mimeType {
+			known = append(known, ext)
+		}
+	}
+	sort.Strings(known)
+	exts = append(exts, known...)
+
+	system, _ := mime.ExtensionsByType(mimeType)
+	return append(exts, system...)
+}
+
+// handlersFor returns the handlers of a file, resolved by its MIME type first and by its
+// lower-cased extension second. Extensions without a handler fall back to the alias of their MIME type.
+func (p WopiServer) handlersFor(extensions map[string][]ExtensionHandler, info *provider.ResourceInfo) []ExtensionHandler {
+	if info.MimeType != "" && info.MimeType != "application/octet-stream" {
+		for _, ext := range p.extensionsByMimeType(info.MimeType) {
+			if handlers, ok := extensions[ext]; ok {
+				return handlers
+			}
+		}
+	}
+
+	ext := strings.ToLower(filepath.Ext(info.Path))
+	if handlers, ok := extensions[ext]; ok {
+		return handlers
+	}
+	if mimeType := mimeTypeByExtension(ext); mimeType != "" {
+		for _, alias := range p.extensionsByMimeType(mimeType) {
+			if handlers, ok := extensions[alias]; ok {
+				return handlers
+			}
+		}
+	}
+
+	return nil
+}
+
+// ExtensionInfo describes which WOPI apps can handle files with an extension.
+type ExtensionInfo struct {
+	Extension string         `json:"extension"`
+	MimeType  string         `json:"mimetype"`
+	Apps      []ExtensionApp `json:"apps"`
+}
+
+// ExtensionApp describes a WOPI app handling an extension and the actions it offers.
+type ExtensionApp struct {
+	Name    string   `json:"name"`
+	IconURL string   `json:"icon,omitempty"`
+	Actions []string `json:"actions"`
+}
+
+// Extensions lists the extensions the WOPI apps can handle, built from their discovery,
+// so that clients do not need to hard-code them.
+func (p WopiServer) Extensions(w http.ResponseWriter, r *http.Request) {
+	extensions, err := p.getExtensions(r.Context())
+	if err != nil {
+		p.writeError(w, r, p.upstreamError(err, "could not get WOPI discovery"))
+		return
+	}
+
+	infos := make([]ExtensionInfo, 0, len(extensions))
+	for ext, handlers := range extensions {
+		info := ExtensionInfo{
+			Extension: strings.TrimPrefix(ext, "."),
+			MimeType:  mimeTypeByExtension(ext),
+		}
+		for _, h := range handlers {
+			info.Apps = append(info.Apps, ExtensionApp{
+				Name:    h.App,
+				IconURL: h.IconURL,
+				Actions: h.actions(),
+			})
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Extension < infos[j].Extension })
+
+	js, err := json.Marshal(infos)
+	if err != nil {
+		p.writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(js)
+}
+
+// actions returns the names of the actions the handler supports.
+func (h ExtensionHandler) actions() []string {
+	actions := []string{}
+	if h.ViewURL != "" {
+		actions = append(actions, "view")
+	}
+	if h.EditURL != "" {
+		actions = append(actions, "edit")
+	}
+	if h.NewURL != "" {
+		actions = append(actions, "new")
+	}
+	if h.ConvertURL != "" {
+		actions = append(actions, "convert")
+	}
+	return actions
+}
@@ -0,0 +1,114 @@
+package svc
+
+import (
+	"context"
+	"time"
+
+	gateway "github.com/cs3org/go-cs3apis/cs3/gateway/v1beta1"
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"go.opencensus.io/trace"
+	"go.opencensus.io/trace/propagation"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// traceMetadataKey is the gRPC metadata key the opencensus gRPC plugin reads the span context from.
+const traceMetadataKey = "grpc-trace-bin"
+
+// gatewayClient is a gateway client which bounds every call by the timeout, runs it in a child
+// span of the span in the context and passes the span context on to the gateway.
+type gatewayClient struct {
+	gateway.GatewayAPIClient
+	timeout time.Duration
+}
+
+func newGatewayClient(client gateway.GatewayAPIClient, timeout time.Duration) gateway.GatewayAPIClient {
+	if client == nil {
+		return nil
+	}
+	return gatewayClient{GatewayAPIClient: client, timeout: timeout}
+}
+
+// gatewayCall is a running call to the gateway.
+type gatewayCall struct {
+	span   *trace.Span
+	cancel context.CancelFunc
+}
+
+// start starts a call to the gateway: its span, its deadline and the span context in the outgoing metadata.
+func (c gatewayClient) start(ctx context.Context, method string) (context.Context, gatewayCall) {
+	ctx, cancel := withTimeout(ctx, c.timeout)
+	ctx, span := trace.StartSpan(ctx, "cs3.gateway."+method, trace.WithSpanKind(trace.SpanKindClient))
+	ctx = metadata.AppendToOutgoingContext(ctx, traceMetadataKey, string(propagation.Binary(span.SpanContext())))
+	return ctx, gatewayCall{span: span, cancel: cancel}
+}
+
+// end ends the call with its outcome.
+func (call gatewayCall) end(s *rpc.Status, err error) {
+	if err != nil {
+		call.span.SetStatus(trace.Status{Code: int32(status.Code(err)), Message: err.Error()})
+	} else {
+		call.span.AddAttributes(trace.StringAttribute("cs3.status", s.GetCode().String()))
+	}
+	call.span.End()
+	call.cancel()
+}
+
+func (c gatewayClient) Stat(ctx context.Context, in *provider.StatRequest, opts ...grpc.CallOption) (*provider.StatResponse, error) {
+	ctx, call := c.start(ctx, "Stat")
+	rsp, err := c.GatewayAPIClient.Stat(ctx, in, opts...)
+	call.end(rsp.GetStatus(), err)
+	return rsp, err
+}
+
+func (c gatewayClient) Move(ctx context.Context, in *provider.MoveRequest, opts ...grpc.CallOption) (*provider.MoveResponse, error) {
+	ctx, call := c.start(ctx, "Move")
+	rsp, err := c.GatewayAPIClient.Move(ctx, in, opts...)
+	call.end(rsp.GetStatus(), err)
+	return rsp, err
+}
+
+func (c gatewayClient) SetArbitraryMetadata(ctx context.Context, in *provider.SetArbitraryMetadataRequest, opts ...grpc.CallOption) (*provider.SetArbitraryMetadataResponse, error) {
+	ctx, call := c.start(ctx, "SetArbitraryMetadata")
+	rsp, err := c.GatewayAPIClient.SetArbitraryMetadata(ctx, in, opts...)
+	call.end(rsp.GetStatus(), err)
+	return rsp, err
+}
+
+func (c gatewayClient) UnsetArbitraryMetadata(ctx context.Context, in *provider.UnsetArbitraryMetadataRequest, opts ...grpc.CallOption) (*provider.UnsetArbitraryMetadataResponse, error) {
+	ctx, call := c.start(ctx, "UnsetArbitraryMetadata")
+	rsp, err := c.GatewayAPIClient.UnsetArbitraryMetadata(ctx, in, opts...)
+	call.end(rsp.GetStatus(), err)
+	return rsp, err
+}
+
+func (c gatewayClient) InitiateFileDownload(ctx context.Context, in *provider.InitiateFileDownloadRequest, opts ...grpc.CallOption) (*gateway.InitiateFileDownloadResponse, error) {
+	ctx, call := c.start(ctx, "InitiateFileDownload")
+	rsp, err := c.GatewayAPIClient.InitiateFileDownload(ctx, in, opts...)
+	call.end(rsp.GetStatus(), err)
+	return rsp, err
+}
+
+func (c gatewayClient) InitiateFileUpload(ctx context.Context, in *provider.InitiateFileUploadRequest, opts ...grpc.CallOption) (*gateway.InitiateFileUploadResponse, error) {
+	ctx, call := c.start(ctx, "InitiateFileUpload")
+	rsp, err := c.GatewayAPIClient.InitiateFileUpload(ctx, in, opts...)
+	call.end(rsp.GetStatus(), err)
+	return rsp, err
+}
+
+func (c gatewayClient) Authenticate(ctx context.Context, in *gateway.AuthenticateRequest, opts ...grpc.CallOption) (*gateway.AuthenticateResponse, error) {
+	ctx, call := c.start(ctx, "Authenticate")
+	rsp, err := c.GatewayAPIClient.Authenticate(ctx, in, opts...)
+	call.end(rsp.GetStatus(), err)
+	return rsp, err
+}
+
+// withTimeout returns a context which is canceled after the timeout, or only with its parent if the timeout is not positive.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
@@ -1,7 +1,10 @@
 package svc
 
 import (
+	"context"
 	"net/http"
+	"sync"
+	"time"
 
 	"github.com/owncloud/ocis-wopiserver/pkg/metrics"
 )
@@ -21,5 +24,75 @@ type instrument struct {
 
 // ServeHTTP implements the Service interface.
 func (i instrument) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	i.next.ServeHTTP(w, r)
+	start := time.Now()
+	rm := &requestMetrics{}
+
+	i.next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestMetricsKey{}, rm)))
+
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	if rm.endpoint != "" {
+		i.metrics.OpenDuration.WithLabelValues(rm.endpoint).Observe(time.Since(start).Seconds())
+	}
+	if rm.opened != nil {
+		i.metrics.DocumentsOpened.WithLabelValues(rm.opened.extension, rm.opened.app, rm.opened.mode).Inc()
+	}
+}
+
+type requestMetricsKey struct{}
+
+// requestMetrics collects what the handlers learn about a request, the instrument records it
+// once the request is done.
+type requestMetrics struct {
+	mu       sync.Mutex
+	endpoint string
+	opened   *openedDocument
+}
+
+type openedDocument struct {
+	extension string
+	app       string
+	mode      string
+}
+
+// requestMetricsFromContext returns the metrics of the request. Requests which are not
+// instrumented get metrics which are not recorded.
+func requestMetricsFromContext(ctx context.Context) *requestMetrics {
+	if rm, ok := ctx.Value(requestMetricsKey{}).(*requestMetrics); ok {
+		return rm
+	}
+	return &requestMetrics{}
+}
+
+// openEndpoint marks the request as a request opening a document through the endpoint.
+func (rm *requestMetrics) openEndpoint(endpoint string) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	rm.endpoint = endpoint
+}
+
+// documentOpened records the document opened by the request.
+func (rm *requestMetrics) documentOpened(extension, app, mode string) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	rm.opened = &openedDocument{extension: extension, app: app, mode: mode}
+}
+
+// Upstreams whose calls are measured.
+const (
+	upstreamStat      = "cs3_stat"
+	upstreamDiscovery = "discovery"
+	upstreamIOPOpen   = "wopi_iop_open"
+)
+
+// observeUpstream records the duration of a call to an upstream and whether it failed.
+func (p WopiServer) observeUpstream(upstream string, start time.Time, failed bool) {
+	if p.metrics == nil {
+		return
+	}
+	p.metrics.UpstreamDuration.WithLabelValues(upstream).Observe(time.Since(start).Seconds())
+	if failed {
+		p.metrics.UpstreamErrors.WithLabelValues(upstream).Inc()
+	}
 }
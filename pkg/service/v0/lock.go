@@ -0,0 +1,288 @@
+package svc
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/token"
+	"github.com/go-chi/chi"
+	"github.com/owncloud/ocis-wopiserver/pkg/audit"
+	"google.golang.org/grpc/metadata"
+)
+
+// maxLockLength is the maximum length of a WOPI lock id.
+const maxLockLength = 1024
+
+// Lock implements the WOPI Lock and UnlockAndRelock operations.
+func (p WopiServer) Lock(w http.ResponseWriter, r *http.Request) {
+	claims := accessTokenClaimsFromContext(r.Context())
+	if !claims.canWrite() {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	revaToken, err := p.serviceToken(r.Context(), claims)
+	if err != nil {
+		p.logger.Error().Err(err).Msg("Lock: could not mint service token")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	ctx := metadata.AppendToOutgoingContext(r.Context(), token.TokenHeader, revaToken)
+
+	requested := r.Header.Get(headerWopiLock)
+	if requested == "" || len(requested) > maxLockLength {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	oldLock := r.Header.Get(headerWopiOldLock)
+
+	defer p.fileMutex.lock(lockKey(claims.resourceID()))()
+
+	expected := requested
+	if oldLock != "" {
+		expected = oldLock
+	}
+	current, err := p.getLock(ctx, claims.resourceID(), expected)
+	if err != nil {
+		p.logger.Error().Err(err).Msg("Lock: could not get lock")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	switch {
+	case oldLock != "" && (current == nil || current.ID != oldLock):
+		lockConflict(w, current, "lock mismatch")
+		return
+	case oldLock == "" && current != nil && current.ID != requested:
+		lockConflict(w, current, "file is locked")
+		return
+	}
+
+	p.setLock(ctx, w, claims, requested)
+}
+
+// RefreshLock implements the WOPI RefreshLock operation.
+func (p WopiServer) RefreshLock(w http.ResponseWriter, r *http.Request) {
+	claims := accessTokenClaimsFromContext(r.Context())
+	if !claims.canWrite() {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	revaToken, err := p.serviceToken(r.Context(), claims)
+	if err != nil {
+		p.logger.Error().Err(err).Msg("RefreshLock: could not mint service token")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	ctx := metadata.AppendToOutgoingContext(r.Context(), token.TokenHeader, revaToken)
+
+	requested := r.Header.Get(headerWopiLock)
+
+	defer p.fileMutex.lock(lockKey(claims.resourceID()))()
+
+	current, err := p.getLock(ctx, claims.resourceID(), requested)
+	if err != nil {
+		p.logger.Error().Err(err).Msg("RefreshLock: could not get lock")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if current == nil || current.ID != requested {
+		lockConflict(w, current, "lock mismatch")
+		return
+	}
+
+	p.setLock(ctx, w, claims, requested)
+}
+
+// Unlock implements the WOPI Unlock operation.
+func (p WopiServer) Unlock(w http.ResponseWriter, r *http.Request) {
+	claims := accessTokenClaimsFromContext(r.Context())
+	if !claims.canWrite() {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	revaToken, err := p.serviceToken(r.Context(), claims)
+	if err != nil {
+		p.logger.Error().Err(err).Msg("Unlock: could not mint service token")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	ctx := metadata.AppendToOutgoingContext(r.Context(), token.TokenHeader, revaToken)
+
+	requested := r.Header.Get(headerWopiLock)
+
+	// the close event records the path of the document
+	statResponse, err := p.stat(r.Context(), chi.URLParam(r, "fileid"), claims.RevaToken)
+	if err != nil {
+		p.logger.Error().Err(err).Msg("Unlock: could not stat file")
+		w.WriteHeader(wopiStatus(err))
+		return
+	}
+
+	defer p.fileMutex.lock(lockKey(claims.resourceID()))()
+
+	current, err := p.getLock(ctx, claims.resourceID(), requested)
+	if err != nil {
+		p.logger.Error().Err(err).Msg("Unlock: could not get lock")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if current == nil || current.ID != requested {
+		lockConflict(w, current, "lock mismatch")
+		return
+	}
+
+	if err := p.lockStore.Unlock(ctx, claims.resourceID()); err != nil {
+		p.logger.Error().Err(err).Msg("Unlock: could not remove lock")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	p.sessions.unlocked(claims.resourceID())
+	p.audit(r, audit.Event{
+		Action:   audit.ActionClose,
+		UserID:   claims.UserID,
+		UserName: claims.UserName,
+		FileID:   wrapResourceID(claims.resourceID()),
+		Path:     statResponse.Info.GetPath(),
+		ViewMode: claims.ViewMode.String(),
+		App:      claims.App,
+	})
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// GetLock implements the WOPI GetLock operation.
+func (p WopiServer) GetLock(w http.ResponseWriter, r *http.Request) {
+	claims := accessTokenClaimsFromContext(r.Context())
+	revaToken, err := p.serviceToken(r.Context(), claims)
+	if err != nil {
+		p.logger.Error().Err(err).Msg("GetLock: could not mint service token")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	ctx := metadata.AppendToOutgoingContext(r.Context(), token.TokenHeader, revaToken)
+
+	current, err := p.getLock(ctx, claims.resourceID(), "")
+	if err != nil {
+		p.logger.Error().Err(err).Msg("GetLock: could not get lock")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if current != nil {
+		w.Header().Set(headerWopiLock, current.ID)
+	} else {
+		w.Header().Set(headerWopiLock, "")
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (p WopiServer) setLock(ctx context.Context, w http.ResponseWriter, claims *accessTokenClaims, lockID string) {
+	expires := time.Now().Add(lockDuration)
+	err := p.lockStore.SetLock(ctx, claims.resourceID(), &Lock{
+		ID:      lockID,
+		Expires: expires,
+	})
+	if err != nil {
+		p.logger.Error().Err(err).Msg("could not set lock")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	p.sessions.locked(claims.resourceID(), expires)
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// checkLock verifies that the lock id sent with a request matches the lock held on the file.
+// Unlocked files may only be written while they are empty. The caller must hold the file mutex.
+// It writes the conflict response and returns false if the request must not proceed.
+func (p WopiServer) checkLock(ctx context.Context, w http.ResponseWriter, claims *accessTokenClaims, lockID string, size uint64) bool {
+	current, err := p.getLock(ctx, claims.resourceID(), lockID)
+	if err != nil {
+		p.logger.Error().Err(err).Msg("could not get lock")
+		w.WriteHeader(http.StatusInternalServerError)
+		return false
+	}
+
+	switch {
+	case current == nil && size != 0:
+		lockConflict(w, nil, "file is not locked")
+		return false
+	case current != nil && current.ID != lockID:
+		lockConflict(w, current, "lock mismatch")
+		return false
+	}
+
+	return true
+}
+
+// getLock returns the lock held on the file. A cached lock which does not match the lock id of the
+// request is read again from the storage, as another replica may have changed it.
+func (p WopiServer) getLock(ctx context.Context, id *provider.ResourceId, lockID string) (*Lock, error) {
+	current, err := p.lockStore.GetLock(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if (current == nil && lockID == "") || (current != nil && current.ID == lockID) {
+		return current, nil
+	}
+
+	p.lockStore.invalidate(id)
+	return p.lockStore.GetLock(ctx, id)
+}
+
+// lockConflict writes a 409 response carrying the current lock.
+func lockConflict(w http.ResponseWriter, current *Lock, reason string) {
+	if current != nil {
+		w.Header().Set(headerWopiLock, current.ID)
+	} else {
+		w.Header().Set(headerWopiLock, "")
+	}
+	w.Header().Set(headerWopiLockFailureReason, reason)
+	w.WriteHeader(http.StatusConflict)
+}
+
+// keyedMutex serializes the lock operations on a file within this replica, so that checking
+// and changing its lock happen at once.
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*keyedLock
+}
+
+type keyedLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+func newKeyedMutex() *keyedMutex {
+	return &keyedMutex{locks: map[string]*keyedLock{}}
+}
+
+// lock locks the key and returns the function unlocking it.
+func (m *keyedMutex) lock(key string) func() {
+	m.mu.Lock()
+	l, ok := m.locks[key]
+	if !ok {
+		l = &keyedLock{}
+		m.locks[key] = l
+	}
+	l.refs++
+	m.mu.Unlock()
+
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+
+		m.mu.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(m.locks, key)
+		}
+		m.mu.Unlock()
+	}
+}
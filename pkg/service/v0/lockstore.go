@@ -0,0 +1,235 @@
+package svc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	gateway "github.com/cs3org/go-cs3apis/cs3/gateway/v1beta1"
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+)
+
+const (
+	// lockDuration is the time after which a WOPI lock expires unless it gets refreshed.
+	lockDuration = 30 * time.Minute
+
+	// lockMetadataKey is the arbitrary metadata key WOPI locks are stored in.
+	lockMetadataKey = "wopi.lock"
+
+	// lockCacheTTL is the time a lock read from the metadata is used without reading it again.
+	// Lock ids not matching the cached lock are always checked against the metadata.
+	lockCacheTTL = 10 * time.Second
+)
+
+// Lock is a WOPI lock held on a file.
+type Lock struct {
+	ID      string    `json:"id"`
+	Expires time.Time `json:"expires"`
+}
+
+// expired reports whether the lock is no longer valid.
+func (l *Lock) expired() bool {
+	return time.Now().After(l.Expires)
+}
+
+// LockStore persists WOPI locks.
+type LockStore interface {
+	// GetLock returns the lock held on the file or nil if the file is not locked.
+	GetLock(ctx context.Context, id *provider.ResourceId) (*Lock, error)
+	// SetLock locks the file, replacing any lock held on it.
+	SetLock(ctx context.Context, id *provider.ResourceId, lock *Lock) error
+	// Unlock removes the lock held on the file.
+	Unlock(ctx context.Context, id *provider.ResourceId) error
+}
+
+// NewMemoryLockStore returns a LockStore which keeps the locks in memory.
+func NewMemoryLockStore() LockStore {
+	return &memoryLockStore{
+		locks: map[string]*Lock{},
+	}
+}
+
+type memoryLockStore struct {
+	mu    sync.Mutex
+	locks map[string]*Lock
+}
+
+func (s *memoryLockStore) GetLock(_ context.Context, id *provider.ResourceId) (*Lock, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lock, ok := s.locks[lockKey(id)]
+	if !ok {
+		return nil, nil
+	}
+	if lock.expired() {
+		delete(s.locks, lockKey(id))
+		return nil, nil
+	}
+
+	l := *lock
+	return &l, nil
+}
+
+func (s *memoryLockStore) SetLock(_ context.Context, id *provider.ResourceId, lock *Lock) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	l := *lock
+	s.locks[lockKey(id)] = &l
+	return nil
+}
+
+func (s *memoryLockStore) Unlock(_ context.Context, id *provider.ResourceId) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.locks, lockKey(id))
+	return nil
+}
+
+func lockKey(id *provider.ResourceId) string {
+	return id.StorageId + ":" + id.OpaqueId
+}
+
+// newCS3LockStore returns a LockStore which keeps the locks in the arbitrary metadata of the
+// locked files, so that they are shared by all replicas of this service. The locks read from the
+// metadata are cached in next for lockCacheTTL. The context passed to it must carry the reva token of the user.
+func newCS3LockStore(next LockStore, client gateway.GatewayAPIClient) *cs3LockStore {
+	return &cs3LockStore{
+		next:     next,
+		client:   client,
+		cachedAt: map[string]time.Time{},
+	}
+}
+
+type cs3LockStore struct {
+	next   LockStore
+	client gateway.GatewayAPIClient
+
+	mu       sync.Mutex
+	cachedAt map[string]time.Time
+}
+
+func (s *cs3LockStore) GetLock(ctx context.Context, id *provider.ResourceId) (*Lock, error) {
+	if s.cached(id) {
+		return s.next.GetLock(ctx, id)
+	}
+
+	rsp, err := s.client.Stat(ctx, &provider.StatRequest{
+		Ref:                   &provider.Reference{ResourceId: id},
+		ArbitraryMetadataKeys: []string{lockMetadataKey},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if rsp.Status.Code != rpc.Code_CODE_OK {
+		return nil, fmt.Errorf("could not stat file: %s", rsp.Status.Message)
+	}
+
+	var lock *Lock
+	if value := rsp.Info.GetArbitraryMetadata().GetMetadata()[lockMetadataKey]; value != "" {
+		lock = &Lock{}
+		if err := json.Unmarshal([]byte(value), lock); err != nil {
+			return nil, err
+		}
+		if lock.expired() {
+			lock = nil
+		}
+	}
+
+	if lock == nil {
+		err = s.next.Unlock(ctx, id)
+	} else {
+		err = s.next.SetLock(ctx, id, lock)
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.cache(id)
+
+	return lock, nil
+}
+
+func (s *cs3LockStore) SetLock(ctx context.Context, id *provider.ResourceId, lock *Lock) error {
+	value, err := json.Marshal(lock)
+	if err != nil {
+		return err
+	}
+
+	rsp, err := s.client.SetArbitraryMetadata(ctx, &provider.SetArbitraryMetadataRequest{
+		Ref: &provider.Reference{ResourceId: id},
+		ArbitraryMetadata: &provider.ArbitraryMetadata{
+			Metadata: map[string]string{lockMetadataKey: string(value)},
+		},
+	})
+	if err != nil {
+		s.invalidate(id)
+		return err
+	}
+	if rsp.Status.Code != rpc.Code_CODE_OK {
+		s.invalidate(id)
+		return fmt.Errorf("could not set lock metadata: %s", rsp.Status.Message)
+	}
+
+	if err := s.next.SetLock(ctx, id, lock); err != nil {
+		s.invalidate(id)
+		return err
+	}
+	s.cache(id)
+	return nil
+}
+
+func (s *cs3LockStore) Unlock(ctx context.Context, id *provider.ResourceId) error {
+	rsp, err := s.client.UnsetArbitraryMetadata(ctx, &provider.UnsetArbitraryMetadataRequest{
+		Ref:                   &provider.Reference{ResourceId: id},
+		ArbitraryMetadataKeys: []string{lockMetadataKey},
+	})
+	if err != nil {
+		s.invalidate(id)
+		return err
+	}
+	if rsp.Status.Code != rpc.Code_CODE_OK && rsp.Status.Code != rpc.Code_CODE_NOT_FOUND {
+		s.invalidate(id)
+		return fmt.Errorf("could not unset lock metadata: %s", rsp.Status.Message)
+	}
+
+	if err := s.next.Unlock(ctx, id); err != nil {
+		s.invalidate(id)
+		return err
+	}
+	s.cache(id)
+	return nil
+}
+
+// cached reports whether the cached lock of the file is recent enough to be used.
+func (s *cs3LockStore) cached(id *provider.ResourceId) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := lockKey(id)
+	cachedAt, ok := s.cachedAt[key]
+	if ok && time.Since(cachedAt) >= lockCacheTTL {
+		delete(s.cachedAt, key)
+		return false
+	}
+	return ok
+}
+
+func (s *cs3LockStore) cache(id *provider.ResourceId) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cachedAt[lockKey(id)] = time.Now()
+}
+
+// invalidate makes the next GetLock read the lock of the file from its metadata.
+func (s *cs3LockStore) invalidate(id *provider.ResourceId) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.cachedAt, lockKey(id))
+}
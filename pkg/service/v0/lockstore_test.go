@@ -0,0 +1,134 @@
+package svc
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	gateway "github.com/cs3org/go-cs3apis/cs3/gateway/v1beta1"
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"google.golang.org/grpc"
+)
+
+func TestMemoryLockStoreExpiry(t *testing.T) {
+	id := &provider.ResourceId{StorageId: "storage", OpaqueId: "file"}
+
+	tests := []struct {
+		name    string
+		expires time.Time
+		want    bool
+	}{
+		{"valid", time.Now().Add(time.Minute), true},
+		{"expired", time.Now().Add(-time.Second), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewMemoryLockStore()
+			if err := s.SetLock(context.Background(), id, &Lock{ID: "lock", Expires: tt.expires}); err != nil {
+				t.Fatal(err)
+			}
+
+			lock, err := s.GetLock(context.Background(), id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := lock != nil; got != tt.want {
+				t.Errorf("GetLock() returned a lock: %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// metadataGateway keeps the arbitrary metadata of a single file, like the storage would.
+type metadataGateway struct {
+	gateway.GatewayAPIClient
+	metadata map[string]string
+	stats    int
+}
+
+func (g *metadataGateway) Stat(ctx context.Context, in *provider.StatRequest, opts ...grpc.CallOption) (*provider.StatResponse, error) {
+	g.stats++
+	return &provider.StatResponse{
+		Status: &rpc.Status{Code: rpc.Code_CODE_OK},
+		Info: &provider.ResourceInfo{
+			ArbitraryMetadata: &provider.ArbitraryMetadata{Metadata: g.metadata},
+		},
+	}, nil
+}
+
+func (g *metadataGateway) SetArbitraryMetadata(ctx context.Context, in *provider.SetArbitraryMetadataRequest, opts ...grpc.CallOption) (*provider.SetArbitraryMetadataResponse, error) {
+	for k, v := range in.ArbitraryMetadata.Metadata {
+		g.metadata[k] = v
+	}
+	return &provider.SetArbitraryMetadataResponse{Status: &rpc.Status{Code: rpc.Code_CODE_OK}}, nil
+}
+
+func (g *metadataGateway) UnsetArbitraryMetadata(ctx context.Context, in *provider.UnsetArbitraryMetadataRequest, opts ...grpc.CallOption) (*provider.UnsetArbitraryMetadataResponse, error) {
+	for _, k := range in.ArbitraryMetadataKeys {
+		delete(g.metadata, k)
+	}
+	return &provider.UnsetArbitraryMetadataResponse{Status: &rpc.Status{Code: rpc.Code_CODE_OK}}, nil
+}
+
+func TestCS3LockStoreSeesOtherReplicas(t *testing.T) {
+	ctx := context.Background()
+	id := &provider.ResourceId{StorageId: "storage", OpaqueId: "file"}
+	g := &metadataGateway{metadata: map[string]string{}}
+
+	a := WopiServer{lockStore: newCS3LockStore(NewMemoryLockStore(), g)}
+	b := WopiServer{lockStore: newCS3LockStore(NewMemoryLockStore(), g)}
+
+	if err := a.lockStore.SetLock(ctx, id, &Lock{ID: "one", Expires: time.Now().Add(time.Minute)}); err != nil {
+		t.Fatal(err)
+	}
+
+	// replica b relocks the file while a still caches the old lock
+	if err := b.lockStore.SetLock(ctx, id, &Lock{ID: "two", Expires: time.Now().Add(time.Minute)}); err != nil {
+		t.Fatal(err)
+	}
+
+	lock, err := a.getLock(ctx, id, "two")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lock == nil || lock.ID != "two" {
+		t.Fatalf("getLock() = %v, want the lock of the other replica", lock)
+	}
+
+	// a matching cached lock is used without reading the metadata
+	stats := g.stats
+	if _, err := a.getLock(ctx, id, "two"); err != nil {
+		t.Fatal(err)
+	}
+	if g.stats != stats {
+		t.Errorf("getLock() read the metadata although the cached lock matches")
+	}
+
+	// replica b unlocks the file
+	if err := b.lockStore.Unlock(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	lock, err = a.getLock(ctx, id, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lock != nil {
+		t.Fatalf("getLock() = %v, want no lock", lock)
+	}
+}
+
+func TestCS3LockStoreIgnoresExpiredLocks(t *testing.T) {
+	id := &provider.ResourceId{StorageId: "storage", OpaqueId: "file"}
+	value, _ := json.Marshal(&Lock{ID: "old", Expires: time.Now().Add(-time.Minute)})
+	g := &metadataGateway{metadata: map[string]string{lockMetadataKey: string(value)}}
+
+	lock, err := newCS3LockStore(NewMemoryLockStore(), g).GetLock(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lock != nil {
+		t.Errorf("GetLock() = %v, want no lock", lock)
+	}
+}
@@ -0,0 +1,134 @@
+package svc
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"io/fs"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	merrors "github.com/asim/go-micro/v3/errors"
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/token"
+	"google.golang.org/grpc/metadata"
+)
+
+// defaultTemplate is the template used for a new file if none is requested,
+// the extension of the file name is appended, e.g. "blank.odt".
+// The default templates are embedded from the templates folder.
+const defaultTemplate = "blank"
+
+//go:embed templates
+var embeddedTemplates embed.FS
+
+// NewFile creates a file from a template in a folder and opens it like OpenFile.
+// The parameters are parentId, the base64 encoded id of the folder, name and template,
+// in the query or the form, which also carries the parameters of OpenFile such as app.
+func (p WopiServer) NewFile(w http.ResponseWriter, r *http.Request) {
+	requestMetricsFromContext(r.Context()).openEndpoint("new")
+
+	user, revaToken, err := p.authenticate(r)
+	if err != nil {
+		p.writeError(w, r, err)
+		return
+	}
+
+	parentID, name, templateID := r.FormValue("parentId"), r.FormValue("name"), r.FormValue("template")
+	if parentID == "" || !validFileName(name) {
+		p.writeError(w, r, merrors.BadRequest(p.serviceID, "parentId or name parameter missing or invalid"))
+		return
+	}
+	if templateID == "" {
+		templateID = defaultTemplate + strings.ToLower(filepath.Ext(name))
+	}
+
+	requestedMode, err := parseViewMode(r.FormValue("viewMode"))
+	if err != nil {
+		p.writeError(w, r, merrors.BadRequest(p.serviceID, "%s", err.Error()))
+		return
+	}
+
+	content, err := p.loadTemplate(templateID)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			err = merrors.BadRequest(p.serviceID, "unknown template %s", templateID)
+		}
+		p.writeError(w, r, err)
+		return
+	}
+	if ext := filepath.Ext(templateID); !strings.EqualFold(filepath.Ext(name), ext) {
+		name += ext
+	}
+
+	parentRef, err := p.fileIDReference(parentID)
+	if err != nil {
+		p.writeError(w, r, err)
+		return
+	}
+
+	ctx := metadata.AppendToOutgoingContext(r.Context(), token.TokenHeader, revaToken)
+
+	parent, err := p.client.Stat(ctx, &provider.StatRequest{Ref: parentRef})
+	switch {
+	case err != nil:
+		p.writeError(w, r, p.upstreamError(err, "could not stat parent folder"))
+		return
+	case parent.Status.Code != rpc.Code_CODE_OK:
+		p.writeError(w, r, p.cs3StatusError(parent.Status, "could not stat parent folder"))
+		return
+	case parent.Info.Type != provider.ResourceType_RESOURCE_TYPE_CONTAINER:
+		p.writeError(w, r, merrors.BadRequest(p.serviceID, "parent is not a folder"))
+		return
+	case !parent.Info.GetPermissionSet().GetInitiateFileUpload():
+		p.writeError(w, r, merrors.Forbidden(p.serviceID, "no permission to create files in the folder"))
+		return
+	}
+
+	target, err := p.uniquePath(ctx, parent.Info.Path, name)
+	switch {
+	case errors.Is(err, errNoFreeFileName):
+		p.writeError(w, r, merrors.Conflict(p.serviceID, "%s", err.Error()))
+		return
+	case err != nil:
+		p.writeError(w, r, p.gatewayError(err, "could not find a free file name"))
+		return
+	}
+
+	if err := p.upload(r.Context(), &provider.Reference{Path: target}, revaToken, bytes.NewReader(content), int64(len(content))); err != nil {
+		p.writeError(w, r, p.gatewayError(err, "could not upload file"))
+		return
+	}
+
+	created, err := p.statPath(ctx, target)
+	if err != nil || created == nil {
+		p.writeError(w, r, merrors.New(p.serviceID, "could not stat created file", http.StatusBadGateway))
+		return
+	}
+
+	p.openInApp(w, r, user, revaToken, created, requestedMode)
+}
+
+// loadTemplate returns the content of a template. Templates in the templates folder
+// of the asset path take precedence over the embedded ones.
+func (p WopiServer) loadTemplate(id string) ([]byte, error) {
+	if !validFileName(id) || strings.HasPrefix(id, ".") {
+		return nil, fs.ErrNotExist
+	}
+
+	if p.config.Asset.Path != "" {
+		content, err := ioutil.ReadFile(filepath.Join(p.config.Asset.Path, "templates", id))
+		if err == nil {
+			return content, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+
+	return embeddedTemplates.ReadFile("templates/" + id)
+}
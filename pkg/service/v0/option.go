@@ -1,10 +1,14 @@
 package svc
 
 import (
+	"context"
 	"net/http"
 
 	gateway "github.com/cs3org/go-cs3apis/cs3/gateway/v1beta1"
+	"github.com/owncloud/ocis-wopiserver/pkg/audit"
+	"github.com/owncloud/ocis-wopiserver/pkg/breaker"
 	"github.com/owncloud/ocis-wopiserver/pkg/config"
+	"github.com/owncloud/ocis-wopiserver/pkg/metrics"
 	"github.com/owncloud/ocis/ocis-pkg/log"
 )
 
@@ -14,9 +18,14 @@ type Option func(o *Options)
 // Options defines the available options for this package.
 type Options struct {
 	Logger     log.Logger
+	Context    context.Context
 	Config     *config.Config
+	Metrics    *metrics.Metrics
 	Middleware []func(http.Handler) http.Handler
 	CS3Client  gateway.GatewayAPIClient
+	LockStore  LockStore
+	Breakers   *breaker.Set
+	Audit      audit.Sink
 }
 
 // newOptions initializes the available default options.
@@ -37,6 +46,20 @@ func Logger(val log.Logger) Option {
 	}
 }
 
+// Context provides a function to set the context option.
+func Context(val context.Context) Option {
+	return func(o *Options) {
+		o.Context = val
+	}
+}
+
+// Metrics provides a function to set the metrics option.
+func Metrics(val *metrics.Metrics) Option {
+	return func(o *Options) {
+		o.Metrics = val
+	}
+}
+
 // Config provides a function to set the config option.
 func Config(val *config.Config) Option {
 	return func(o *Options) {
@@ -56,3 +79,24 @@ func CS3Client(c gateway.GatewayAPIClient) Option {
 		o.CS3Client = c
 	}
 }
+
+// Locks provides a function to set the lock store option.
+func Locks(val LockStore) Option {
+	return func(o *Options) {
+		o.LockStore = val
+	}
+}
+
+// Breakers provides a function to set the circuit breakers of the WOPI hosts.
+func Breakers(val *breaker.Set) Option {
+	return func(o *Options) {
+		o.Breakers = val
+	}
+}
+
+// Audit provides a function to set the audit sink option.
+func Audit(val audit.Sink) Option {
+	return func(o *Options) {
+		o.Audit = val
+	}
+}
@@ -0,0 +1,162 @@
+package svc
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	headerWopiProof     = "X-WOPI-Proof"
+	headerWopiProofOld  = "X-WOPI-ProofOld"
+	headerWopiTimestamp = "X-WOPI-TimeStamp"
+
+	// proofMaxAge is the maximum difference between the timestamp of a proven WOPI request and now.
+	proofMaxAge = 20 * time.Minute
+
+	// unixEpochTicks is the Unix epoch in .NET ticks, the unit of X-WOPI-TimeStamp.
+	unixEpochTicks = 621355968000000000
+)
+
+// discoveryProofKey holds the current and the old public key a WOPI app signs its requests with.
+// https://wopi.readthedocs.io/en/latest/scenarios/proofkeys.html
+type discoveryProofKey struct {
+	Modulus     string `xml:"modulus,attr"`
+	Exponent    string `xml:"exponent,attr"`
+	OldModulus  string `xml:"oldmodulus,attr"`
+	OldExponent string `xml:"oldexponent,attr"`
+}
+
+// publicKeys returns the current and the old public key. The old one is nil if not published.
+func (k discoveryProofKey) publicKeys() (current, old *rsa.PublicKey, err error) {
+	if k.Modulus == "" || k.Exponent == "" {
+		return nil, nil, errors.New("WOPI discovery contains no proof key")
+	}
+
+	current, err = rsaPublicKey(k.Modulus, k.Exponent)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if k.OldModulus != "" && k.OldExponent != "" {
+		old, err = rsaPublicKey(k.OldModulus, k.OldExponent)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return current, old, nil
+}
+
+func rsaPublicKey(modulus, exponent string) (*rsa.PublicKey, error) {
+	n, err := base64.StdEncoding.DecodeString(modulus)
+	if err != nil {
+		return nil, err
+	}
+	e, err := base64.StdEncoding.DecodeString(exponent)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(n),
+		E: int(new(big.Int).SetBytes(e).Int64()),
+	}, nil
+}
+
+// ProofKeys verifies that WOPI requests are signed by the WOPI app. Requests failing the
+// verification are rejected if the enforcement is enabled and only logged otherwise.
+func (p WopiServer) ProofKeys(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := p.verifyProof(r); err != nil {
+			if p.config.WopiServer.EnforceProofKeys {
+				p.logger.Warn().Err(err).Str("path", r.URL.Path).Msg("rejecting WOPI request with invalid proof")
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			p.logger.Debug().Err(err).Str("path", r.URL.Path).Msg("WOPI request has an invalid proof")
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (p WopiServer) verifyProof(r *http.Request) error {
+	ticks, err := strconv.ParseInt(r.Header.Get(headerWopiTimestamp), 10, 64)
+	if err != nil {
+		return errors.New("missing or invalid " + headerWopiTimestamp)
+	}
+	// timestamps in the future are as suspicious as old ones, a replayed request may carry either
+	if age := time.Since(time.Unix(0, (ticks-unixEpochTicks)*100)); age > proofMaxAge || age < -proofMaxAge {
+		return errors.New("WOPI request timestamp is out of range")
+	}
+
+	proof, err := base64.StdEncoding.DecodeString(r.Header.Get(headerWopiProof))
+	if err != nil {
+		return errors.New("invalid " + headerWopiProof)
+	}
+	proofOld, err := base64.StdEncoding.DecodeString(r.Header.Get(headerWopiProofOld))
+	if err != nil {
+		return errors.New("invalid " + headerWopiProofOld)
+	}
+
+	requestURL := strings.TrimSuffix(p.config.WopiServer.PublicURL, "/") + r.URL.RequestURI()
+	digest := sha256.Sum256(expectedProof(r.URL.Query().Get("access_token"), requestURL, ticks))
+
+	// the request does not tell which WOPI app sent it, so the proof keys of all apps are tried
+	err = errors.New("WOPI proof does not match")
+	for _, app := range p.apps {
+		discovery, discoveryErr := app.discovery.get(r.Context())
+		if discoveryErr != nil {
+			err = discoveryErr
+			continue
+		}
+		current, old, keyErr := discovery.ProofKey.publicKeys()
+		if keyErr != nil {
+			err = keyErr
+			continue
+		}
+
+		// the request may be signed with the current key, or the keys may have been rotated
+		// on either side: https://wopi.readthedocs.io/en/latest/scenarios/proofkeys.html#verifying-the-proof-keys
+		if verifySignature(current, digest[:], proof) ||
+			verifySignature(current, digest[:], proofOld) ||
+			verifySignature(old, digest[:], proof) {
+			return nil
+		}
+	}
+
+	return err
+}
+
+// expectedProof builds the data a WOPI app signs for a request.
+func expectedProof(accessToken, requestURL string, ticks int64) []byte {
+	token := []byte(accessToken)
+	u := []byte(strings.ToUpper(requestURL))
+
+	var b bytes.Buffer
+	_ = binary.Write(&b, binary.BigEndian, int32(len(token)))
+	b.Write(token)
+	_ = binary.Write(&b, binary.BigEndian, int32(len(u)))
+	b.Write(u)
+	_ = binary.Write(&b, binary.BigEndian, int32(8))
+	_ = binary.Write(&b, binary.BigEndian, ticks)
+
+	return b.Bytes()
+}
+
+func verifySignature(key *rsa.PublicKey, digest, signature []byte) bool {
+	if key == nil || len(signature) == 0 {
+		return false
+	}
+	return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest, signature) == nil
+}
@@ -0,0 +1,144 @@
+package svc
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"math/big"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/owncloud/ocis-wopiserver/pkg/config"
+)
+
+func TestExpectedProof(t *testing.T) {
+	got := expectedProof("tok", "https://h/x?a=b", 0x0102030405060708)
+
+	var want []byte
+	want = append(want, 0, 0, 0, 3)
+	want = append(want, "tok"...)
+	want = append(want, 0, 0, 0, 15)
+	want = append(want, "HTTPS://H/X?A=B"...)
+	want = append(want, 0, 0, 0, 8)
+	want = append(want, 1, 2, 3, 4, 5, 6, 7, 8)
+
+	if !bytes.Equal(got, want) {
+		t.Errorf("expectedProof() = %x, want %x", got, want)
+	}
+}
+
+// A proof signed for this test with a fixed key, as published in the discovery of a WOPI app.
+const (
+	knownProofModulus   = "pbRxxbQrRjWltTaSD/g1ZMMSxjYSp2Fl3vzdzpWkdAAk+m/tsNVwsTjimgRLbxO7U/sQHe/sNE76OLETkkYCiTzcjnYqiTFAWDR1pxEpuLLpZwyCZqng7x1TUQ4/t8XeCRpulDvC4VfwNLrzWDwQTCiBaDkdQEDm0/QUF2KVKXk="
+	knownProofExponent  = "AQAB"
+	knownProofURL       = "https://host.example/api/v0/wopi/files/abc?access_token=tok"
+	knownProofTicks     = 637000000000000000
+	knownProofSignature = "YPStMxTL1Owowfx2/EfyQjq4AkZxh0ek5abSshed5duG/FEuETmkE4VjSniDTy9vABfxmfzT7kuIhe1qYrDlmBkeHfEY/RNsGj1r1l5Xlrg9SQqZeFGmD6eYTy/5/44342hEY8aZRb7lX2V0h+xYEMfeAZdbTP48UXZ/IIVrZs4="
+)
+
+func TestVerifyKnownProof(t *testing.T) {
+	key, _, err := discoveryProofKey{Modulus: knownProofModulus, Exponent: knownProofExponent}.publicKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, err := base64.StdEncoding.DecodeString(knownProofSignature)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		url   string
+		ticks int64
+		want  bool
+	}{
+		{"signed request", knownProofURL, knownProofTicks, true},
+		{"url case is ignored", "HTTPS://HOST.EXAMPLE/API/V0/WOPI/FILES/ABC?ACCESS_TOKEN=TOK", knownProofTicks, true},
+		{"other url", knownProofURL + "&x=1", knownProofTicks, false},
+		{"other timestamp", knownProofURL, knownProofTicks + 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			digest := sha256.Sum256(expectedProof("tok", tt.url, tt.ticks))
+			if got := verifySignature(key, digest[:], signature); got != tt.want {
+				t.Errorf("verifySignature() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyProofKeyRotation(t *testing.T) {
+	current, old, unknown := generateProofKey(t), generateProofKey(t), generateProofKey(t)
+
+	cfg := config.New()
+	cfg.WopiServer.PublicURL = "https://host.example/"
+	p := WopiServer{config: cfg}
+	proofKey := discoveryProofKey{
+		Modulus:     base64.StdEncoding.EncodeToString(current.N.Bytes()),
+		Exponent:    base64.StdEncoding.EncodeToString(big.NewInt(int64(current.E)).Bytes()),
+		OldModulus:  base64.StdEncoding.EncodeToString(old.N.Bytes()),
+		OldExponent: base64.StdEncoding.EncodeToString(big.NewInt(int64(old.E)).Bytes()),
+	}
+	fetch := func(context.Context, string) (*wopiDiscovery, error) {
+		return &wopiDiscovery{ProofKey: proofKey}, nil
+	}
+	p.apps = []*wopiApp{{discovery: newDiscoveryCache("app", time.Hour, fetch, p.logger, nil)}}
+
+	tests := []struct {
+		name      string
+		proof     *rsa.PrivateKey
+		proofOld  *rsa.PrivateKey
+		timestamp time.Time
+		wantErr   bool
+	}{
+		{"current key", current, old, time.Now(), false},
+		{"app rotated its keys before the discovery was refreshed", unknown, current, time.Now(), false},
+		{"discovery refreshed before the app rotated its keys", old, unknown, time.Now(), false},
+		{"old key as old proof only", unknown, old, time.Now(), true},
+		{"unknown keys", unknown, unknown, time.Now(), true},
+		{"no proof", nil, nil, time.Now(), true},
+		{"too old", current, old, time.Now().Add(-proofMaxAge - time.Minute), true},
+		{"in the future", current, old, time.Now().Add(proofMaxAge + time.Minute), true},
+		{"slightly in the future", current, old, time.Now().Add(time.Minute), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ticks := tt.timestamp.UnixNano()/100 + unixEpochTicks
+			r := httptest.NewRequest("GET", "/api/v0/wopi/files/abc?access_token=tok", nil)
+			r.Header.Set(headerWopiTimestamp, strconv.FormatInt(ticks, 10))
+			digest := sha256.Sum256(expectedProof("tok", "https://host.example/api/v0/wopi/files/abc?access_token=tok", ticks))
+			r.Header.Set(headerWopiProof, signProof(t, tt.proof, digest[:]))
+			r.Header.Set(headerWopiProofOld, signProof(t, tt.proofOld, digest[:]))
+
+			if err := p.verifyProof(r); (err != nil) != tt.wantErr {
+				t.Errorf("verifyProof() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func generateProofKey(t *testing.T) *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// signProof returns the base64 encoded signature of the digest, or an empty proof without a key.
+func signProof(t *testing.T, key *rsa.PrivateKey, digest []byte) string {
+	if key == nil {
+		return ""
+	}
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(signature)
+}
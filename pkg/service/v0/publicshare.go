@@ -0,0 +1,70 @@
+package svc
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+
+	merrors "github.com/asim/go-micro/v3/errors"
+	gateway "github.com/cs3org/go-cs3apis/cs3/gateway/v1beta1"
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+)
+
+// publicTokenHeader carries the token of a public share, like for the public WebDAV endpoints.
+const publicTokenHeader = "public-token"
+
+// publicShareToken returns the public share token of the request from the header or the query.
+func publicShareToken(r *http.Request) string {
+	if t := r.Header.Get(publicTokenHeader); t != "" {
+		return t
+	}
+	return r.URL.Query().Get(publicTokenHeader)
+}
+
+// authenticate returns the user and the reva token of a request. Requests carrying a public share
+// token are authenticated against the public share, all others need a logged in user.
+func (p WopiServer) authenticate(r *http.Request) (*userpb.User, string, error) {
+	if publicToken := publicShareToken(r); publicToken != "" {
+		// the password of a protected share is sent as basic auth password, the user name is ignored
+		_, password, _ := r.BasicAuth()
+		return p.authenticatePublicShare(r.Context(), publicToken, password)
+	}
+
+	user, revaToken, err := getUserAndAuthToken(r, p.config.TokenManager)
+	if errors.Is(err, errUnauthenticated) {
+		return nil, "", merrors.Unauthorized(p.serviceID, "%s", err.Error())
+	}
+	return user, revaToken, err
+}
+
+// authenticatePublicShare exchanges a public share token and its password for a reva token scoped to the share.
+// The user returned by the gateway is the share owner, so the WOPI client gets a guest user instead.
+func (p WopiServer) authenticatePublicShare(ctx context.Context, publicToken, password string) (*userpb.User, string, error) {
+	res, err := p.client.Authenticate(ctx, &gateway.AuthenticateRequest{
+		Type:         "publicshares",
+		ClientId:     publicToken,
+		ClientSecret: "password|" + password,
+	})
+	if err != nil {
+		return nil, "", p.upstreamError(err, "could not authenticate public share")
+	}
+	if res.Status.Code != rpc.Code_CODE_OK {
+		return nil, "", merrors.Unauthorized(p.serviceID, "could not authenticate public share: %s", res.Status.Message)
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, "", err
+	}
+	guest := &userpb.User{
+		Id: &userpb.UserId{
+			OpaqueId: "guest-" + hex.EncodeToString(id),
+		},
+		DisplayName: p.config.WopiServer.GuestName,
+	}
+
+	return guest, res.Token, nil
+}
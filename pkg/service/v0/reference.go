@@ -0,0 +1,74 @@
+package svc
+
+import (
+	"net/url"
+	"path"
+	"strings"
+
+	merrors "github.com/asim/go-micro/v3/errors"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+)
+
+// requestReference resolves the file of an open request. The file is identified by exactly one of
+// fileId (the base64 encoded "storageid:opaqueid"), an absolute path, or spaceId and relativePath.
+func (p WopiServer) requestReference(q url.Values) (*provider.Reference, error) {
+	fileID, filePath, spaceID := q.Get("fileId"), q.Get("path"), q.Get("spaceId")
+
+	given := 0
+	for _, v := range []string{fileID, filePath, spaceID} {
+		if v != "" {
+			given++
+		}
+	}
+	switch {
+	case given == 0:
+		return nil, merrors.BadRequest(p.serviceID, "fileId, path or spaceId parameter missing in request")
+	case given > 1:
+		return nil, merrors.BadRequest(p.serviceID, "only one of fileId, path or spaceId may be given")
+	}
+
+	switch {
+	case fileID != "":
+		return p.fileIDReference(fileID)
+	case filePath != "":
+		if !path.IsAbs(filePath) {
+			return nil, merrors.BadRequest(p.serviceID, "path must be absolute")
+		}
+		return &provider.Reference{Path: path.Clean(filePath)}, nil
+	default:
+		relativePath := q.Get("relativePath")
+		if relativePath == "" {
+			return nil, merrors.BadRequest(p.serviceID, "relativePath parameter missing in request")
+		}
+		root := spaceRoot(spaceID)
+		if root == nil {
+			return nil, merrors.BadRequest(p.serviceID, "invalid spaceId")
+		}
+		return &provider.Reference{ResourceId: root, Path: "." + path.Clean("/"+relativePath)}, nil
+	}
+}
+
+// fileIDReference returns the reference of a base64 encoded "storageid:opaqueid" file id.
+func (p WopiServer) fileIDReference(fileID string) (*provider.Reference, error) {
+	resourceID := unwrapResourceID(fileID)
+	if resourceID == nil {
+		return nil, merrors.BadRequest(p.serviceID, "invalid fileId")
+	}
+	return &provider.Reference{ResourceId: resourceID}, nil
+}
+
+// spaceRoot returns the root of a space id. Space ids are either "storageid!opaqueid" or
+// a bare storage id, whose root shares the id with the storage.
+func spaceRoot(spaceID string) *provider.ResourceId {
+	parts := strings.SplitN(spaceID, "!", 2)
+	if len(parts) == 1 {
+		parts = append(parts, parts[0])
+	}
+	if parts[0] == "" || parts[1] == "" {
+		return nil
+	}
+	return &provider.ResourceId{
+		StorageId: parts[0],
+		OpaqueId:  parts[1],
+	}
+}
@@ -0,0 +1,277 @@
+package svc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/token"
+	"github.com/go-chi/chi"
+	"github.com/owncloud/ocis-wopiserver/pkg/audit"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	headerWopiSuggestedTarget         = "X-WOPI-SuggestedTarget"
+	headerWopiRelativeTarget          = "X-WOPI-RelativeTarget"
+	headerWopiOverwriteRelativeTarget = "X-WOPI-OverwriteRelativeTarget"
+	headerWopiValidRelativeTarget     = "X-WOPI-ValidRelativeTarget"
+	headerWopiSize                    = "X-WOPI-Size"
+)
+
+// PutRelativeFileResponse is the response of the WOPI PutRelativeFile operation.
+// https://wopi.readthedocs.io/projects/wopirest/en/latest/files/PutRelativeFile.html
+type PutRelativeFileResponse struct {
+	Name        string `json:"Name"`
+	URL         string `json:"Url"`
+	HostViewURL string `json:"HostViewUrl,omitempty"`
+	HostEditURL string `json:"HostEditUrl,omitempty"`
+}
+
+// PutRelativeFile implements the WOPI PutRelativeFile operation.
+// It creates a new file next to the file the access token was issued for.
+func (p WopiServer) PutRelativeFile(w http.ResponseWriter, r *http.Request) {
+	claims := accessTokenClaimsFromContext(r.Context())
+	if !claims.canWrite() {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	revaToken, err := p.serviceToken(r.Context(), claims)
+	if err != nil {
+		p.logger.Error().Err(err).Msg("PutRelativeFile: could not mint service token")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	ctx := metadata.AppendToOutgoingContext(r.Context(), token.TokenHeader, revaToken)
+
+	suggested, relative := r.Header.Get(headerWopiSuggestedTarget), r.Header.Get(headerWopiRelativeTarget)
+	if (suggested == "") == (relative == "") {
+		// exactly one of the headers must be present
+		w.WriteHeader(http.StatusNotImplemented)
+		return
+	}
+
+	statResponse, err := p.stat(r.Context(), chi.URLParam(r, "fileid"), claims.RevaToken)
+	if err != nil {
+		p.logger.Error().Err(err).Msg("PutRelativeFile: could not stat file")
+		w.WriteHeader(wopiStatus(err))
+		return
+	}
+	dir := filepath.Dir(statResponse.Info.Path)
+
+	// the service token may write anywhere the user may, so check the folder explicitly
+	parent, err := p.statPath(ctx, dir)
+	if err != nil {
+		p.logger.Error().Err(err).Msg("PutRelativeFile: could not stat folder")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !parent.GetPermissionSet().GetInitiateFileUpload() {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var target string
+	if suggested != "" {
+		name, err := decodeUTF7(suggested)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if strings.HasPrefix(name, ".") {
+			// only an extension was suggested, keep the name of the original file
+			base := filepath.Base(statResponse.Info.Path)
+			name = strings.TrimSuffix(base, filepath.Ext(base)) + name
+		}
+		if !validFileName(name) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		target, err = p.uniquePath(ctx, dir, name)
+		if err != nil {
+			p.logger.Error().Err(err).Msg("PutRelativeFile: could not find a free file name")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	} else {
+		name, err := decodeUTF7(relative)
+		if err != nil || !validFileName(name) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		target = filepath.Join(dir, name)
+
+		existing, err := p.statPath(ctx, target)
+		if err != nil {
+			p.logger.Error().Err(err).Msg("PutRelativeFile: could not stat target")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if existing != nil {
+			overwrite, _ := strconv.ParseBool(r.Header.Get(headerWopiOverwriteRelativeTarget))
+			if !overwrite {
+				valid, err := p.uniquePath(ctx, dir, name)
+				if err != nil {
+					p.logger.Error().Err(err).Msg("PutRelativeFile: could not find a free file name")
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				w.Header().Set(headerWopiValidRelativeTarget, filepath.Base(valid))
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+
+			lock, err := p.getLock(ctx, existing.Id, "")
+			if err != nil {
+				p.logger.Error().Err(err).Msg("PutRelativeFile: could not get lock of target")
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			if lock != nil {
+				lockConflict(w, lock, "target file is locked")
+				return
+			}
+		}
+	}
+
+	size := r.ContentLength
+	if s, err := strconv.ParseInt(r.Header.Get(headerWopiSize), 10, 64); err == nil {
+		size = s
+	}
+	if size < 0 {
+		// the storage needs the size before the upload starts
+		w.WriteHeader(http.StatusLengthRequired)
+		return
+	}
+
+	if err := p.upload(r.Context(), &provider.Reference{Path: target}, revaToken, r.Body, size); err != nil {
+		p.logger.Error().Err(err).Str("target", target).Msg("PutRelativeFile: could not upload file")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	created, err := p.statPath(ctx, target)
+	if err != nil || created == nil {
+		p.logger.Error().Err(err).Str("target", target).Msg("PutRelativeFile: could not stat created file")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	p.audit(r, audit.Event{
+		Action:   audit.ActionSave,
+		UserID:   claims.UserID,
+		UserName: claims.UserName,
+		FileID:   wrapResourceID(created.Id),
+		Path:     created.Path,
+		ViewMode: claims.ViewMode.String(),
+		App:      claims.App,
+	})
+
+	newClaims := *claims
+	newClaims.StorageID = created.Id.StorageId
+	newClaims.OpaqueID = created.Id.OpaqueId
+	if claims.ResourceScoped {
+		// the reva token of the session is limited to the original file
+		user, err := p.sessionUser(r.Context(), claims)
+		if err == nil {
+			newClaims.RevaToken, err = p.resourceToken(r.Context(), user, created, newClaims.ViewMode)
+		}
+		if err != nil {
+			p.logger.Error().Err(err).Msg("PutRelativeFile: could not mint reva token")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+	accessToken, err := mintAccessToken(newClaims, p.config.WopiServer.Secret, p.sessionTTL(newClaims.ViewMode))
+	if err != nil {
+		p.logger.Error().Err(err).Msg("PutRelativeFile: could not mint access token")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	rsp := PutRelativeFileResponse{
+		Name: filepath.Base(created.Path),
+		URL:  p.builtinWopiSrc(created.Id) + "?access_token=" + url.QueryEscape(accessToken),
+	}
+
+	if extensions, err := p.getExtensions(r.Context()); err == nil {
+		if handler, ok := selectHandler(p.handlersFor(extensions, created), claims.App); ok {
+			wopiSrc := p.escapedBuiltinWopiSrc(created.Id)
+			if u, _, err := p.clientURL(r, handler.ViewURL, wopiSrc, created); err == nil {
+				rsp.HostViewURL = u.String()
+			}
+			if u, _, err := p.clientURL(r, handler.EditURL, wopiSrc, created); err == nil {
+				rsp.HostEditURL = u.String()
+			}
+		}
+	} else {
+		p.logger.Error().Err(err).Msg("PutRelativeFile: could not get extensions")
+	}
+
+	js, err := json.Marshal(rsp)
+	if err != nil {
+		p.logger.Error().Err(err).Msg("PutRelativeFile: could not marshal response")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(js)
+}
+
+// statPath returns the resource info at the path or nil if there is no resource.
+// The context must carry the reva token of the user.
+func (p WopiServer) statPath(ctx context.Context, path string) (*provider.ResourceInfo, error) {
+	rsp, err := p.client.Stat(ctx, &provider.StatRequest{Ref: &provider.Reference{Path: path}})
+	if err != nil {
+		return nil, err
+	}
+
+	switch rsp.Status.Code {
+	case rpc.Code_CODE_OK:
+		return rsp.Info, nil
+	case rpc.Code_CODE_NOT_FOUND:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("could not stat %s: %w", path, cs3StatusErr{rsp.Status})
+	}
+}
+
+// errNoFreeFileName is returned by uniquePath if all candidate names are taken.
+var errNoFreeFileName = errors.New("no free file name")
+
+// uniquePath returns a path in dir for the file name which is not used yet,
+// appending " (1)", " (2)", … to the name if necessary.
+func (p WopiServer) uniquePath(ctx context.Context, dir, name string) (string, error) {
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+
+	candidate := filepath.Join(dir, name)
+	for i := 1; i <= 100; i++ {
+		info, err := p.statPath(ctx, candidate)
+		if err != nil {
+			return "", err
+		}
+		if info == nil {
+			return candidate, nil
+		}
+		candidate = filepath.Join(dir, fmt.Sprintf("%s (%d)%s", base, i, ext))
+	}
+
+	return "", fmt.Errorf("%w for %s", errNoFreeFileName, name)
+}
+
+// validFileName reports whether name can be used as the name of a file in the same folder.
+func validFileName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, `/\`)
+}
@@ -0,0 +1,130 @@
+package svc
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/token"
+	"github.com/go-chi/chi"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	headerWopiRequestedName        = "X-WOPI-RequestedName"
+	headerWopiInvalidFileNameError = "X-WOPI-InvalidFileNameError"
+)
+
+// RenameFileResponse is the response of the WOPI RenameFile operation.
+// https://wopi.readthedocs.io/projects/wopirest/en/latest/files/RenameFile.html
+type RenameFileResponse struct {
+	Name string `json:"Name"`
+}
+
+// RenameFile implements the WOPI RenameFile operation.
+// The file keeps its extension and stays in its folder.
+func (p WopiServer) RenameFile(w http.ResponseWriter, r *http.Request) {
+	claims := accessTokenClaimsFromContext(r.Context())
+	if !claims.canWrite() {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	revaToken, err := p.serviceToken(r.Context(), claims)
+	if err != nil {
+		p.logger.Error().Err(err).Msg("RenameFile: could not mint service token")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	ctx := metadata.AppendToOutgoingContext(r.Context(), token.TokenHeader, revaToken)
+
+	requested, err := decodeUTF7(r.Header.Get(headerWopiRequestedName))
+	if err != nil || !validFileName(requested) {
+		invalidFileName(w, "invalid file name")
+		return
+	}
+
+	statResponse, err := p.stat(r.Context(), chi.URLParam(r, "fileid"), claims.RevaToken)
+	if err != nil {
+		p.logger.Error().Err(err).Msg("RenameFile: could not stat file")
+		w.WriteHeader(wopiStatus(err))
+		return
+	}
+	info := statResponse.Info
+	if !info.GetPermissionSet().GetMove() {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	defer p.fileMutex.lock(lockKey(claims.resourceID()))()
+
+	current, err := p.getLock(ctx, claims.resourceID(), r.Header.Get(headerWopiLock))
+	if err != nil {
+		p.logger.Error().Err(err).Msg("RenameFile: could not get lock")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if current != nil && current.ID != r.Header.Get(headerWopiLock) {
+		lockConflict(w, current, "lock mismatch")
+		return
+	}
+
+	ext := filepath.Ext(info.Path)
+	requested = strings.TrimSuffix(requested, ext)
+	target := filepath.Join(filepath.Dir(info.Path), requested+ext)
+
+	if target != info.Path {
+		existing, err := p.statPath(ctx, target)
+		if err != nil {
+			p.logger.Error().Err(err).Msg("RenameFile: could not stat target")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if existing != nil {
+			invalidFileName(w, "a file with this name already exists")
+			return
+		}
+
+		rsp, err := p.client.Move(ctx, &provider.MoveRequest{
+			Source:      &provider.Reference{ResourceId: claims.resourceID()},
+			Destination: &provider.Reference{Path: target},
+		})
+		if err != nil {
+			p.logger.Error().Err(err).Msg("RenameFile: could not move file")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		switch rsp.Status.Code {
+		case rpc.Code_CODE_OK:
+		case rpc.Code_CODE_ALREADY_EXISTS:
+			invalidFileName(w, "a file with this name already exists")
+			return
+		case rpc.Code_CODE_NOT_FOUND:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		default:
+			p.logger.Error().Str("status_message", rsp.Status.Message).Msg("RenameFile: could not move file")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	js, err := json.Marshal(RenameFileResponse{Name: requested})
+	if err != nil {
+		p.logger.Error().Err(err).Msg("RenameFile: could not marshal response")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(js)
+}
+
+// invalidFileName writes a 400 response carrying the reason why a file name was rejected.
+func invalidFileName(w http.ResponseWriter, reason string) {
+	w.Header().Set(headerWopiInvalidFileNameError, reason)
+	w.WriteHeader(http.StatusBadRequest)
+}
@@ -0,0 +1,105 @@
+package svc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/owncloud/ocis-wopiserver/pkg/breaker"
+	"github.com/owncloud/ocis-wopiserver/pkg/metrics"
+)
+
+// wopiHostTransport sends the requests to the WOPI hosts, the WOPI apps and the CS3 WOPI server, through
+// the circuit breaker of the host and retries idempotent requests which failed with a network error or
+// while the host was unavailable.
+type wopiHostTransport struct {
+	next     http.RoundTripper
+	breakers *breaker.Set
+	attempts int
+	backoff  time.Duration
+	metrics  *metrics.Metrics
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (t wopiHostTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	b := t.breakers.Get(req.URL.Host)
+
+	attempts := t.attempts
+	if attempts < 1 || !idempotent(req) {
+		attempts = 1
+	}
+
+	for attempt := 1; ; attempt++ {
+		if err := b.Allow(); err != nil {
+			return nil, fmt.Errorf("%s: %w", req.URL.Host, err)
+		}
+
+		rsp, err := t.next.RoundTrip(req)
+		switch {
+		case err == nil && !unavailable(rsp.StatusCode):
+			b.Success()
+			return rsp, nil
+		case ctx.Err() == context.Canceled:
+			// the caller gave up, which tells nothing about the host
+			b.Abort()
+			return rsp, err
+		}
+		b.Failure()
+
+		if attempt >= attempts || ctx.Err() != nil {
+			return rsp, err
+		}
+		if rsp != nil {
+			io.Copy(ioutil.Discard, rsp.Body)
+			rsp.Body.Close()
+		}
+
+		if t.metrics != nil {
+			t.metrics.UpstreamRetries.WithLabelValues(req.URL.Host).Inc()
+		}
+		if err := sleep(ctx, retryBackoff(t.backoff, attempt)); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// idempotent reports whether the request may be sent again.
+func idempotent(req *http.Request) bool {
+	if req.Body != nil && req.Body != http.NoBody {
+		return false
+	}
+	return req.Method == http.MethodGet || req.Method == http.MethodHead
+}
+
+// unavailable reports whether the status code tells that the host is restarting or overloaded.
+func unavailable(code int) bool {
+	return code == http.StatusBadGateway || code == http.StatusServiceUnavailable || code == http.StatusGatewayTimeout
+}
+
+// retryBackoff returns the wait before the retry: the base doubled per retry, jittered down to its half
+// so that the retries of concurrent requests spread out.
+func retryBackoff(base time.Duration, retry int) time.Duration {
+	d := base << (retry - 1)
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// sleep waits for the duration or until the context is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,30 @@
+package svc
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRetryBackoff(t *testing.T) {
+	tests := []struct {
+		base     time.Duration
+		retry    int
+		min, max time.Duration
+	}{
+		{100 * time.Millisecond, 1, 50 * time.Millisecond, 100 * time.Millisecond},
+		{100 * time.Millisecond, 2, 100 * time.Millisecond, 200 * time.Millisecond},
+		{100 * time.Millisecond, 4, 400 * time.Millisecond, 800 * time.Millisecond},
+		{0, 1, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s retry %d", tt.base, tt.retry), func(t *testing.T) {
+			// the jitter is random, so every backoff is sampled a few times
+			for i := 0; i < 100; i++ {
+				if got := retryBackoff(tt.base, tt.retry); got < tt.min || got > tt.max {
+					t.Fatalf("retryBackoff(%s, %d) = %s, want between %s and %s", tt.base, tt.retry, got, tt.min, tt.max)
+				}
+			}
+		})
+	}
+}
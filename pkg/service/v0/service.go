@@ -6,17 +6,20 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"errors"
-	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"path"
 	"path/filepath"
 	"strings"
 	"time"
 	"unicode/utf8"
 
 	merrors "github.com/asim/go-micro/v3/errors"
+	appprovider "github.com/cs3org/go-cs3apis/cs3/app/provider/v1beta1"
+	authpb "github.com/cs3org/go-cs3apis/cs3/auth/provider/v1beta1"
 	gateway "github.com/cs3org/go-cs3apis/cs3/gateway/v1beta1"
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
 	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
 	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
 	"github.com/cs3org/reva/pkg/auth/scope"
@@ -26,9 +29,13 @@ import (
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
 	"github.com/owncloud/ocis-wopiserver/pkg/assets"
+	"github.com/owncloud/ocis-wopiserver/pkg/audit"
+	"github.com/owncloud/ocis-wopiserver/pkg/breaker"
 	"github.com/owncloud/ocis-wopiserver/pkg/config"
+	"github.com/owncloud/ocis-wopiserver/pkg/metrics"
 	"github.com/owncloud/ocis/ocis-pkg/log"
 	ocsm "github.com/owncloud/ocis/ocis-pkg/middleware"
+	"go.opencensus.io/plugin/ochttp"
 	"google.golang.org/grpc/metadata"
 )
 
@@ -53,24 +60,80 @@ func NewService(opts ...Option) Service {
 		options.Config.HTTP.CacheTTL,
 	))
 
-	svc := WopiServer{
-		serviceID: options.Config.HTTP.Namespace + "." + options.Config.Server.Name,
-		logger:    options.Logger,
-		config:    options.Config,
-		mux:       m,
-		httpClient: &http.Client{Transport: &http.Transport{
+	transport := &ochttp.Transport{
+		Base: &http.Transport{
 			TLSClientConfig: &tls.Config{
 				InsecureSkipVerify: options.Config.WopiServer.Insecure,
 			},
+		},
+	}
+
+	breakers := options.Breakers
+	if breakers == nil {
+		breakers = breaker.NewSet(
+			breaker.Threshold(options.Config.WopiServer.BreakerThreshold),
+			breaker.Cooldown(options.Config.WopiServer.BreakerCooldown),
+		)
+	}
+
+	svc := WopiServer{
+		serviceID:  options.Config.HTTP.Namespace + "." + options.Config.Server.Name,
+		logger:     options.Logger,
+		config:     options.Config,
+		mux:        m,
+		httpClient: &http.Client{Transport: transport},
+		hostClient: &http.Client{Transport: wopiHostTransport{
+			next:     transport,
+			breakers: breakers,
+			attempts: options.Config.WopiServer.RetryAttempts,
+			backoff:  options.Config.WopiServer.RetryBackoff,
+			metrics:  options.Metrics,
 		}},
-		client: options.CS3Client,
+		client:    newGatewayClient(options.CS3Client, options.Config.WopiServer.GatewayTimeout),
+		metrics:   options.Metrics,
+		sessions:  newSessionTracker(),
+		fileMutex: newKeyedMutex(),
+		auditSink: options.Audit,
+	}
+
+	if svc.metrics != nil {
+		if err := svc.metrics.RegisterActiveSessions(svc.sessions.active); err != nil {
+			options.Logger.Error().
+				Err(err).
+				Str("metric", "active_sessions").
+				Msg("Failed to register prometheus metric")
+		}
+	}
+
+	lockStore := options.LockStore
+	if lockStore == nil {
+		lockStore = NewMemoryLockStore()
+	}
+	svc.lockStore = newCS3LockStore(lockStore, svc.client)
+
+	svc.apps = newWopiApps(options.Config.WopiServer, svc.getDiscovery, options.Logger, options.Metrics)
+	if options.Context != nil && options.Config.WopiServer.DiscoveryTTL > 0 {
+		for _, app := range svc.apps {
+			go app.discovery.run(options.Context)
+		}
 	}
 
 	m.Route(options.Config.HTTP.Root, func(r chi.Router) {
 		r.NotFound(svc.NotFound)
 		r.Use(middleware.StripSlashes)
 		r.Get("/api/v0/wopi/open", svc.OpenFile)
-
+		r.Post("/api/v0/wopi/new", svc.NewFile)
+		r.Get("/api/v0/wopi/extensions", svc.Extensions)
+
+		// the static middleware only hands requests below /api to the router, so the WOPI endpoints live there as well
+		r.Route("/api/v0/wopi/files/{fileid}", func(r chi.Router) {
+			r.Use(svc.ProofKeys)
+			r.Use(svc.WopiContext)
+			r.Get("/", svc.CheckFileInfo)
+			r.Post("/", svc.FileOperation)
+			r.Get("/contents", svc.GetFile)
+			r.Post("/contents", svc.PutFile)
+		})
 	})
 
 	return svc
@@ -83,7 +146,14 @@ type WopiServer struct {
 	config     *config.Config
 	mux        *chi.Mux
 	httpClient *http.Client
+	hostClient *http.Client
 	client     gateway.GatewayAPIClient
+	lockStore  *cs3LockStore
+	fileMutex  *keyedMutex
+	apps       []*wopiApp
+	metrics    *metrics.Metrics
+	sessions   *sessionTracker
+	auditSink  audit.Sink
 }
 
 // ServeHTTP implements the Service interface.
@@ -102,153 +172,231 @@ type WopiResponse struct {
 }
 
 func (p WopiServer) OpenFile(w http.ResponseWriter, r *http.Request) {
+	requestMetricsFromContext(r.Context()).openEndpoint("open")
+
+	user, revaToken, err := p.authenticate(r)
+	if err != nil {
+		p.writeError(w, r, err)
+		return
+	}
 
-	username, revaToken, err := getUserAndAuthToken(r, p.config.TokenManager)
+	ref, err := p.requestReference(r.URL.Query())
 	if err != nil {
-		p.logger.Logger.Err(err)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		p.writeError(w, r, err)
 		return
 	}
 
-	fileID := r.URL.Query().Get("fileId")
-	if fileID == "" {
-		pathErr := errors.New("fileID parameter missing in request")
-		p.logger.Logger.Err(pathErr)
-		http.Error(w, pathErr.Error(), http.StatusBadRequest)
+	requestedMode, err := parseViewMode(r.URL.Query().Get("viewMode"))
+	if err != nil {
+		p.writeError(w, r, merrors.BadRequest(p.serviceID, "%s", err.Error()))
 		return
 	}
 
-	statResponse, err := p.stat(fileID, revaToken)
+	statResponse, err := p.statReference(r.Context(), ref, revaToken)
 	if err != nil {
-		p.logger.Logger.Err(err)
-		http.Error(w, "could not stat file", http.StatusBadRequest)
+		p.writeError(w, r, err)
 		return
 	}
 
-	extensions, err := p.getExtensions()
+	p.openInApp(w, r, user, revaToken, statResponse.Info, requestedMode)
+}
+
+// openInApp selects the WOPI app and the view mode for the file and writes the WopiResponse
+// with the WOPI client URL and the access token.
+func (p WopiServer) openInApp(w http.ResponseWriter, r *http.Request, user *userpb.User, revaToken string, info *provider.ResourceInfo, requestedMode appprovider.OpenInAppRequest_ViewMode) {
+	extensions, err := p.getExtensions(r.Context())
 	if err != nil {
-		p.logger.Logger.Err(err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		p.writeError(w, r, p.upstreamError(err, "could not get WOPI discovery"))
 		return
 	}
 
-	extensionHandler, found := extensions[filepath.Ext(statResponse.Info.Path)]
+	app := r.FormValue("app")
+	extensionHandler, found := selectHandler(p.handlersFor(extensions, info), app)
 	if !found {
-		err = errors.New("file type " + filepath.Ext(statResponse.Info.Path) + " is not supported")
-		p.logger.Logger.Err(err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		fileType := firstNonEmpty(filepath.Ext(info.Path), info.MimeType)
+		if app != "" {
+			p.writeError(w, r, merrors.New(p.serviceID, "app "+app+" cannot open file type "+fileType, http.StatusUnsupportedMediaType))
+			return
+		}
+		p.writeError(w, r, merrors.New(p.serviceID, "file type "+fileType+" is not supported", http.StatusUnsupportedMediaType))
 		return
 	}
 
-	wopiClientHost := ""
-	viewMode := ""
-	canEdit := statResponse.Info.PermissionSet.InitiateFileUpload
-	canView := statResponse.Info.PermissionSet.InitiateFileDownload
-	isEmpty := statResponse.Info.Size == 0
-
-	if canEdit && canView && isEmpty {
-		wopiClientHost = extensionHandler.NewURL //let WOPI client do the file initialization
-		viewMode = "VIEW_MODE_READ_WRITE"
-	} else if canEdit && canView && !isEmpty {
-		wopiClientHost = extensionHandler.EditURL
-		viewMode = "VIEW_MODE_READ_WRITE"
-	} else if !canEdit && canView && !isEmpty {
-		wopiClientHost = extensionHandler.ViewURL
-		viewMode = "VIEW_MODE_READ_ONLY"
-		//} else if !canEdit && canView && !isEmpty {
-		//	 TODO: this branch will never be entered
-		//	 permission set is not really useful for this case -> need to use this https://github.com/cs3org/cs3apis/blob/master/cs3/app/provider/v1beta1/provider_api.proto#L79
-		//	wopiClientHost = extensionHandler.ViewURL
-		//	viewMode = "VIEW_MODE_VIEW_ONLY"
-	} else {
+	decision := decideOpen(requestedMode, info, extensionHandler)
+	p.logDecision(user, info, extensionHandler.App, decision)
+	if decision.Outcome == outcomeForbidden {
+		p.audit(r, audit.Event{
+			Action:   audit.ActionOpenDenied,
+			UserID:   user.GetId().GetOpaqueId(),
+			UserName: user.GetDisplayName(),
+			FileID:   wrapResourceID(info.Id),
+			Path:     info.Path,
+			App:      extensionHandler.App,
+			Reason:   decision.Reason,
+		})
+		p.writeError(w, r, merrors.Forbidden(p.serviceID, "%s", decision.Reason))
 		return
 	}
 
+	// public share tokens are already limited to the share, all others are narrowed down to the file
+	resourceScoped := publicShareToken(r) == ""
+	if resourceScoped {
+		revaToken, err = p.resourceToken(r.Context(), user, info, decision.Mode)
+		if err != nil {
+			p.writeError(w, r, err)
+			return
+		}
+	}
+
 	wopiSrc, err := p.getWopiSrc(
-		statResponse.Info.Id.OpaqueId, viewMode,
-		statResponse.Info.Id.StorageId, filepath.Dir(statResponse.Info.Path),
-		username, revaToken,
+		r.Context(),
+		info.Id.OpaqueId, decision.Mode,
+		info.Id.StorageId, filepath.Dir(info.Path),
+		extensionHandler.App, user, revaToken, resourceScoped,
 	)
 	if err != nil {
-		p.logger.Logger.Err(err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		p.writeError(w, r, err)
 		return
 	}
 
-	u, err := url.Parse(wopiClientHost + "&WOPISrc=" + wopiSrc)
+	u, accessToken, err := p.clientURL(r, decision.URL, wopiSrc, info)
 	if err != nil {
-		p.logger.Logger.Err(err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		p.writeError(w, r, err)
 		return
 	}
 
-	q := u.Query()
-
-	// remove access token from query parameters
-	accessToken := q.Get("access_token")
-	q.Del("access_token")
-
-	// more options used by oC 10:
-	// &lang=en-GB
-	// &closebutton=1
-	// &revisionhistory=1
-	// &title=Hello.odt
-	u.RawQuery = q.Encode()
+	// the CS3 WOPI server mints the access token with its own lifetime, so its expiry is taken from the token
+	expires, ok := tokenExpiry(accessToken)
+	if !ok {
+		expires = time.Now().Add(p.sessionTTL(decision.Mode))
+	}
 
 	js, err := json.Marshal(
 		WopiResponse{
 			WopiClientURL: u.String(),
 			AccessToken:   accessToken,
 			// https://wopi.readthedocs.io/projects/wopirest/en/latest/concepts.html#term-access-token-ttl
-			AccessTokenTTL: time.Now().Add(p.config.TokenManager.TokenTTL).UnixNano() / 1e6,
+			AccessTokenTTL: expires.UnixNano() / 1e6,
 		},
 	)
 	if err != nil {
-		p.logger.Logger.Err(err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		p.writeError(w, r, err)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.Write(js)
 
+	p.audit(r, audit.Event{
+		Action:   audit.ActionOpen,
+		UserID:   user.GetId().GetOpaqueId(),
+		UserName: user.GetDisplayName(),
+		FileID:   wrapResourceID(info.Id),
+		Path:     info.Path,
+		ViewMode: decision.Mode.String(),
+		App:      extensionHandler.App,
+		Reason:   decision.Reason,
+	})
+	requestMetricsFromContext(r.Context()).documentOpened(
+		strings.TrimPrefix(strings.ToLower(filepath.Ext(info.Path)), "."),
+		extensionHandler.App,
+		decision.Outcome.String(),
+	)
 }
 
-type ExtensionHandler struct {
-	ViewURL string `json:"view"`
-	EditURL string `json:"edit"`
-	NewURL  string `json:"new"`
+// logDecision logs how a file is opened, or why it may not be opened.
+func (p WopiServer) logDecision(user *userpb.User, info *provider.ResourceInfo, app string, decision openDecision) {
+	event := p.logger.Info()
+	if decision.Outcome == outcomeForbidden {
+		event = p.logger.Warn()
+	}
+	event.
+		Str("user", user.GetId().GetOpaqueId()).
+		Str("storageid", info.GetId().GetStorageId()).
+		Str("opaqueid", info.GetId().GetOpaqueId()).
+		Str("app", app).
+		Str("decision", decision.Outcome.String()).
+		Str("viewmode", decision.Mode.String()).
+		Str("reason", decision.Reason).
+		Msg("open decision")
 }
 
-func (p WopiServer) getExtensions() (extensions map[string]ExtensionHandler, err error) {
+// clientURL builds the URL of the WOPI client handler for the file with the client options of
+// the request. The WOPISrc must be query escaped and may be followed by the access token.
+func (p WopiServer) clientURL(r *http.Request, handlerURL, wopiSrc string, info *provider.ResourceInfo) (*url.URL, string, error) {
+	return wopiClientURL(handlerURL, wopiSrc, p.wopiClientOptions(r, info))
+}
+
+// wopiClientURL builds the URL of the WOPI client from the handler URL, the WOPISrc and the
+// client options and returns it together with the access token contained in the WOPISrc.
+func wopiClientURL(handlerURL, wopiSrc string, options url.Values) (*url.URL, string, error) {
+	lang := options.Get("lang")
+	handlerURL = substituteURLSrc(handlerURL, map[string]string{
+		"UI_LLCC": lang,
+		"DC_LLCC": lang,
+	})
 
-	r, err := p.httpClient.Get(p.config.WopiServer.Host + "/wopi/cbox/endpoints")
+	u, err := url.Parse(handlerURL + "&WOPISrc=" + wopiSrc)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
-	defer r.Body.Close()
 
-	if r.StatusCode != http.StatusOK {
-		return nil, errors.New("get /wopi/cbox/endpoints failed: status code != 200")
-	}
+	q := u.Query()
 
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		return nil, err
+	// remove access token from query parameters
+	accessToken := q.Get("access_token")
+	q.Del("access_token")
+
+	for k, v := range options {
+		q[k] = v
 	}
+	u.RawQuery = q.Encode()
 
-	extensions = map[string]ExtensionHandler{}
-	err = json.Unmarshal(body, &extensions)
-	if err != nil {
+	return u, accessToken, nil
+}
+
+type ExtensionHandler struct {
+	App        string `json:"app"`
+	ViewURL    string `json:"view"`
+	EditURL    string `json:"edit"`
+	NewURL     string `json:"new"`
+	ConvertURL string `json:"convert"`
+	IconURL    string `json:"icon"`
+}
+
+// getExtensions returns the handlers of all WOPI apps per extension, ordered by the priority of the apps.
+// Apps whose discovery is unavailable are skipped.
+func (p WopiServer) getExtensions(ctx context.Context) (extensions map[string][]ExtensionHandler, err error) {
+	extensions = map[string][]ExtensionHandler{}
+	available := 0
+	for _, app := range p.apps {
+		handlers, appErr := app.extensions(ctx)
+		if appErr != nil {
+			p.logger.Error().Err(appErr).Str("app", app.Name).Msg("could not get extensions of WOPI app")
+			err = appErr
+			continue
+		}
+		available++
+		for ext, handler := range handlers {
+			extensions[ext] = append(extensions[ext], handler)
+		}
+	}
+	if available == 0 {
 		return nil, err
 	}
 
-	return extensions, err
+	return extensions, nil
 }
 
-func (p WopiServer) getWopiSrc(fileRef, viewMode, storageID, folderURL, userName, revaToken string) (b string, err error) {
+func (p WopiServer) getWopiSrc(ctx context.Context, fileRef string, viewMode appprovider.OpenInAppRequest_ViewMode, storageID, folderURL, app string, user *userpb.User, revaToken string, resourceScoped bool) (b string, err error) {
+	if p.config.WopiServer.Builtin {
+		return p.getBuiltinWopiSrc(fileRef, viewMode, storageID, app, user, revaToken, resourceScoped)
+	}
+
+	ctx, cancel := withTimeout(ctx, p.config.WopiServer.IOPTimeout)
+	defer cancel()
 
-	req, err := http.NewRequest("GET", p.config.WopiServer.Host+"/wopi/iop/open", nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.config.WopiServer.Host+"/wopi/iop/open", nil)
 	if err != nil {
 		return "", err
 	}
@@ -258,112 +406,282 @@ func (p WopiServer) getWopiSrc(fileRef, viewMode, storageID, folderURL, userName
 
 	q := req.URL.Query()
 	q.Add("filename", fileRef) // can be the file path or an opaque ID
-	q.Add("viewmode", viewMode)
+	q.Add("viewmode", viewMode.String())
 	q.Add("folderurl", folderURL)
 	q.Add("endpoint", storageID)
-	q.Add("username", userName)
+	q.Add("username", user.DisplayName)
 	req.URL.RawQuery = q.Encode()
 
-	r, err := p.httpClient.Do(req)
+	start := time.Now()
+	r, err := p.hostClient.Do(req)
+	p.observeUpstream(upstreamIOPOpen, start, err != nil || r.StatusCode != http.StatusOK)
 	if err != nil {
-		return "", err
+		return "", p.upstreamError(err, "get /wopi/iop/open failed")
 	}
 	defer r.Body.Close()
 
 	if r.StatusCode != http.StatusOK {
-		return "", errors.New("get /wopi/iop/open failed: status code != 200")
+		return "", merrors.New(p.serviceID, "get /wopi/iop/open failed: status code != 200", http.StatusBadGateway)
 	}
 
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		return "", err
+		return "", p.upstreamError(err, "get /wopi/iop/open failed")
 	}
 
 	return string(body), err
 }
 
-func (p WopiServer) stat(fileID, auth string) (*provider.StatResponse, error) {
-	ctx := metadata.AppendToOutgoingContext(context.Background(), token.TokenHeader, auth)
+// getBuiltinWopiSrc returns the WOPISrc and access token of the built-in WOPI endpoints
+// in the same format as the CS3 WOPI server does.
+func (p WopiServer) getBuiltinWopiSrc(fileRef string, viewMode appprovider.OpenInAppRequest_ViewMode, storageID, app string, user *userpb.User, revaToken string, resourceScoped bool) (string, error) {
+	accessToken, err := mintAccessToken(
+		accessTokenClaims{
+			RevaToken:      revaToken,
+			StorageID:      storageID,
+			OpaqueID:       fileRef,
+			ViewMode:       viewMode,
+			App:            app,
+			UserID:         user.Id.OpaqueId,
+			UserName:       user.DisplayName,
+			ResourceScoped: resourceScoped,
+		},
+		p.config.WopiServer.Secret,
+		p.sessionTTL(viewMode),
+	)
+	if err != nil {
+		return "", err
+	}
 
-	// taken from reva - ocdav
-	unwrap := func(rid string) *provider.ResourceId {
-		decodedID, err := base64.URLEncoding.DecodeString(rid)
-		if err != nil {
-			return nil
-		}
+	return p.escapedBuiltinWopiSrc(&provider.ResourceId{StorageId: storageID, OpaqueId: fileRef}) + "&access_token=" + accessToken, nil
+}
 
-		parts := strings.SplitN(string(decodedID), ":", 2)
-		if len(parts) != 2 {
-			return nil
-		}
+// builtinWopiSrc returns the WOPISrc of a file served by the built-in WOPI endpoints.
+func (p WopiServer) builtinWopiSrc(id *provider.ResourceId) string {
+	return strings.TrimSuffix(p.config.WopiServer.PublicURL, "/") +
+		path.Join("/", p.config.HTTP.Root, "api/v0/wopi/files", wrapResourceID(id))
+}
 
-		if !utf8.ValidString(parts[0]) || !utf8.ValidString(parts[1]) {
-			return nil
-		}
+// escapedBuiltinWopiSrc returns the query escaped WOPISrc of a file served by the built-in WOPI endpoints.
+func (p WopiServer) escapedBuiltinWopiSrc(id *provider.ResourceId) string {
+	return url.QueryEscape(p.builtinWopiSrc(id))
+}
 
-		return &provider.ResourceId{
-			StorageId: parts[0],
-			OpaqueId:  parts[1],
-		}
+// stat stats the file with the base64 encoded file id.
+func (p WopiServer) stat(ctx context.Context, fileID, auth string) (*provider.StatResponse, error) {
+	ref, err := p.fileIDReference(fileID)
+	if err != nil {
+		return nil, err
 	}
+	return p.statReference(ctx, ref, auth)
+}
 
-	resourceID := unwrap(fileID)
-	if resourceID == nil {
-		return nil, errors.New("unwrap fileID failed")
-	}
+// statReference stats the referenced file and maps the CS3 status to an error.
+func (p WopiServer) statReference(ctx context.Context, ref *provider.Reference, auth string) (*provider.StatResponse, error) {
+	ctx = metadata.AppendToOutgoingContext(ctx, token.TokenHeader, auth)
 
 	req := &provider.StatRequest{
-
-		Ref: &provider.Reference{
-			ResourceId: resourceID,
-		},
+		Ref: ref,
 	}
+	start := time.Now()
 	rsp, err := p.client.Stat(ctx, req)
+	p.observeUpstream(upstreamStat, start, cs3Failed(rsp.GetStatus(), err))
 	if err != nil {
-		p.logger.Logger.Error().Err(err).Str("fileID", fileID).Msg("could not stat file")
-		return nil, merrors.InternalServerError(p.serviceID, "could not stat file: %s", err.Error())
+		p.logger.Logger.Error().Err(err).Interface("ref", ref).Msg("could not stat file")
+		return nil, p.upstreamError(err, "could not stat file")
 	}
 
 	if rsp.Status.Code != rpc.Code_CODE_OK {
-		switch rsp.Status.Code {
-		case rpc.Code_CODE_NOT_FOUND:
-			return nil, merrors.NotFound(p.serviceID, "could not stat file: %s", rsp.Status.Message)
-		default:
-			p.logger.Logger.Error().Str("status_message", rsp.Status.Message).Str("fileID", fileID).Msg("could not stat file")
-			return nil, merrors.InternalServerError(p.serviceID, "could not stat file: %s", rsp.Status.Message)
+		if rsp.Status.Code != rpc.Code_CODE_NOT_FOUND {
+			p.logger.Logger.Error().Str("status_message", rsp.Status.Message).Interface("ref", ref).Msg("could not stat file")
 		}
+		return nil, p.cs3StatusError(rsp.Status, "could not stat file")
 	}
 	if rsp.Info.Type != provider.ResourceType_RESOURCE_TYPE_FILE {
-		return nil, merrors.BadRequest(p.serviceID, "Unsupported file type")
+		return nil, merrors.New(p.serviceID, "Unsupported file type", http.StatusUnsupportedMediaType)
 	}
 	return rsp, nil
 }
 
-func getUserAndAuthToken(r *http.Request, tm config.TokenManager) (username, revaToken string, err error) {
+// unwrapResourceID decodes a base64 encoded "storageid:opaqueid" file id.
+// taken from reva - ocdav
+func unwrapResourceID(rid string) *provider.ResourceId {
+	decodedID, err := base64.URLEncoding.DecodeString(rid)
+	if err != nil {
+		return nil
+	}
 
-	ctx := r.Context()
+	parts := strings.SplitN(string(decodedID), ":", 2)
+	if len(parts) != 2 {
+		return nil
+	}
+
+	if !utf8.ValidString(parts[0]) || !utf8.ValidString(parts[1]) {
+		return nil
+	}
+
+	return &provider.ResourceId{
+		StorageId: parts[0],
+		OpaqueId:  parts[1],
+	}
+}
+
+// wrapResourceID encodes a resource id the way unwrapResourceID expects it.
+func wrapResourceID(id *provider.ResourceId) string {
+	return base64.URLEncoding.EncodeToString([]byte(id.StorageId + ":" + id.OpaqueId))
+}
 
-	tokenManager, err := revajwt.New(map[string]interface{}{
-		"secret":  tm.JWTSecret,
-		"expires": tm.TokenTTL.Seconds(),
+// newTokenManager returns the reva token manager minting tokens with the given lifetime.
+func newTokenManager(secret string, ttl time.Duration) (token.Manager, error) {
+	return revajwt.New(map[string]interface{}{
+		"secret":  secret,
+		"expires": ttl.Seconds(),
 	})
+}
+
+// sessionTTL returns the lifetime of the tokens of a session in the view mode.
+func (p WopiServer) sessionTTL(mode appprovider.OpenInAppRequest_ViewMode) time.Duration {
+	tm := p.config.TokenManager
+	ttl := tm.ViewTokenTTL
+	if mode == appprovider.OpenInAppRequest_VIEW_MODE_READ_WRITE {
+		ttl = tm.EditTokenTTL
+	}
+	if ttl <= 0 {
+		return tm.TokenTTL
+	}
+	return ttl
+}
+
+// tokenExpiry returns the expiry of a JWT from its exp claim without verifying the token.
+func tokenExpiry(t string) (time.Time, bool) {
+	parts := strings.Split(t, ".")
+	if len(parts) != 3 {
+		return time.Time{}, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	var claims struct {
+		ExpiresAt int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.ExpiresAt == 0 {
+		return time.Time{}, false
+	}
+
+	return time.Unix(claims.ExpiresAt, 0), true
+}
+
+// resourceToken mints a reva token for the user which is limited to the resource, as viewer or,
+// for read-write sessions, as editor. The owner-scoped token of the user never leaves this service.
+func (p WopiServer) resourceToken(ctx context.Context, user *userpb.User, info *provider.ResourceInfo, mode appprovider.OpenInAppRequest_ViewMode) (string, error) {
+	tokenManager, err := newTokenManager(p.config.TokenManager.JWTSecret, p.sessionTTL(mode))
+	if err != nil {
+		return "", err
+	}
+
+	role := authpb.Role_ROLE_VIEWER
+	if mode == appprovider.OpenInAppRequest_VIEW_MODE_READ_WRITE {
+		role = authpb.Role_ROLE_EDITOR
+	}
+	scopes, err := scope.AddResourceInfoScope(info, role, nil)
+	if err != nil {
+		return "", err
+	}
+
+	return tokenManager.MintToken(ctx, user, scopes)
+}
+
+// serviceTokenTTL is the lifetime of the reva tokens minted by serviceToken, which are only
+// used for the requests of a single WOPI operation.
+const serviceTokenTTL = time.Minute
+
+// serviceToken returns the reva token for the requests this service sends on behalf of a
+// session next to its file: creating and renaming files in its folder and keeping its lock
+// in the file metadata. Tokens limited to the file allow none of them, so for such sessions
+// a short-lived owner-scoped token is minted for the user of the session. Unlike the token
+// in the access token claims, it never leaves this service.
+func (p WopiServer) serviceToken(ctx context.Context, claims *accessTokenClaims) (string, error) {
+	if !claims.ResourceScoped {
+		return claims.RevaToken, nil
+	}
+
+	user, err := p.sessionUser(ctx, claims)
+	if err != nil {
+		return "", err
+	}
+	tokenManager, err := newTokenManager(p.config.TokenManager.JWTSecret, serviceTokenTTL)
+	if err != nil {
+		return "", err
+	}
+	scopes, err := scope.GetOwnerScope()
+	if err != nil {
+		return "", err
+	}
+
+	return tokenManager.MintToken(ctx, user, scopes)
+}
+
+// contentToken returns the reva token GetFile downloads the content with. Users of view-only
+// sessions may not download the file themselves, so for them a short-lived token limited to the
+// file is minted for its owner. It never leaves this service, and the WOPI app is told to disable
+// printing, exporting and copying the content.
+func (p WopiServer) contentToken(ctx context.Context, claims *accessTokenClaims, info *provider.ResourceInfo) (string, error) {
+	if claims.ViewMode != appprovider.OpenInAppRequest_VIEW_MODE_VIEW_ONLY {
+		return claims.RevaToken, nil
+	}
+	if info.GetOwner() == nil {
+		return "", errors.New("file has no owner")
+	}
+
+	tokenManager, err := newTokenManager(p.config.TokenManager.JWTSecret, serviceTokenTTL)
+	if err != nil {
+		return "", err
+	}
+	scopes, err := scope.AddResourceInfoScope(info, authpb.Role_ROLE_VIEWER, nil)
+	if err != nil {
+		return "", err
+	}
+
+	return tokenManager.MintToken(ctx, &userpb.User{Id: info.Owner}, scopes)
+}
+
+// sessionUser returns the user the reva token of the session was minted for.
+func (p WopiServer) sessionUser(ctx context.Context, claims *accessTokenClaims) (*userpb.User, error) {
+	tokenManager, err := newTokenManager(p.config.TokenManager.JWTSecret, p.config.TokenManager.TokenTTL)
 	if err != nil {
-		return "", "", err
+		return nil, err
+	}
+	user, _, err := tokenManager.DismantleToken(ctx, claims.RevaToken)
+	return user, err
+}
+
+// getUserAndAuthToken returns the logged in user and an owner-scoped reva token,
+// which must only be used by this service itself.
+func getUserAndAuthToken(r *http.Request, tm config.TokenManager) (user *userpb.User, revaToken string, err error) {
+
+	ctx := r.Context()
+
+	tokenManager, err := newTokenManager(tm.JWTSecret, tm.TokenTTL)
+	if err != nil {
+		return nil, "", err
 	}
 
-	user := revauser.ContextMustGetUser(ctx)
+	user, ok := revauser.ContextGetUser(ctx)
+	if !ok {
+		return nil, "", errUnauthenticated
+	}
 	scope, err := scope.GetOwnerScope()
 	if err != nil {
-		return "", "", err
+		return nil, "", err
 	}
 
 	revaToken, err = tokenManager.MintToken(ctx, user, scope)
 	if err != nil {
-		return "", "", err
+		return nil, "", err
 	}
 
-	username = user.DisplayName
-
 	// TODO: if CS3org WOPI server mints the final REVA JWT secret,
 	// the temporary REVA JWT token and the user display name can also be obtained like that:
 	//
@@ -390,7 +708,7 @@ func getUserAndAuthToken(r *http.Request, tm config.TokenManager) (username, rev
 	//	return "", "", tokenErr
 	//}
 	//
-	//username = claims.User.DisplayName
+	//user = claims.User
 
-	return username, revaToken, nil
+	return user, revaToken, nil
 }
@@ -0,0 +1,51 @@
+package svc
+
+import (
+	"sync"
+	"time"
+
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+)
+
+// sessionTracker keeps the editing sessions of this instance. An editing session is active
+// while it holds a WOPI lock, so it ends with the unlock or the expiry of the lock.
+type sessionTracker struct {
+	mu       sync.Mutex
+	sessions map[string]time.Time
+}
+
+func newSessionTracker() *sessionTracker {
+	return &sessionTracker{
+		sessions: map[string]time.Time{},
+	}
+}
+
+// locked starts or extends the session on the file.
+func (t *sessionTracker) locked(id *provider.ResourceId, expires time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.sessions[lockKey(id)] = expires
+}
+
+// unlocked ends the session on the file.
+func (t *sessionTracker) unlocked(id *provider.ResourceId) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.sessions, lockKey(id))
+}
+
+// active drops the expired sessions and returns the number of the remaining ones.
+func (t *sessionTracker) active() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	for k, expires := range t.sessions {
+		if now.After(expires) {
+			delete(t.sessions, k)
+		}
+	}
+	return len(t.sessions)
+}
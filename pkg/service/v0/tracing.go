@@ -2,17 +2,20 @@ package svc
 
 import (
 	"net/http"
+
+	"go.opencensus.io/plugin/ochttp"
 )
 
-// NewTracing returns a service that instruments traces.
+// NewTracing returns a service that instruments traces. Every request gets a span, which continues
+// the trace of the trace headers of the request. The spans of the upstream calls are its children.
 func NewTracing(next Service) Service {
 	return tracing{
-		next: next,
+		next: &ochttp.Handler{Handler: next},
 	}
 }
 
 type tracing struct {
-	next Service
+	next http.Handler
 }
 
 // ServeHTTP implements the Service interface.
@@ -0,0 +1,121 @@
+package svc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	gateway "github.com/cs3org/go-cs3apis/cs3/gateway/v1beta1"
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	types "github.com/cs3org/go-cs3apis/cs3/types/v1beta1"
+	"github.com/cs3org/reva/pkg/token"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// transferTokenHeader carries the transfer token to the reva data gateway.
+	transferTokenHeader = "X-Reva-Transfer"
+
+	// simpleProtocol is the data transfer protocol used for downloads and uploads.
+	simpleProtocol = "simple"
+)
+
+// download opens the content of the referenced file through the reva data gateway.
+func (p WopiServer) download(ctx context.Context, ref *provider.Reference, revaToken string) (io.ReadCloser, error) {
+	ctx = metadata.AppendToOutgoingContext(ctx, token.TokenHeader, revaToken)
+
+	rsp, err := p.client.InitiateFileDownload(ctx, &provider.InitiateFileDownloadRequest{Ref: ref})
+	if err != nil {
+		return nil, err
+	}
+	if rsp.Status.Code != rpc.Code_CODE_OK {
+		return nil, fmt.Errorf("initiate file download failed: %w", cs3StatusErr{rsp.Status})
+	}
+
+	var endpoint, transferToken string
+	for _, proto := range rsp.Protocols {
+		if proto.Protocol == simpleProtocol {
+			endpoint, transferToken = proto.DownloadEndpoint, proto.Token
+			break
+		}
+	}
+	if endpoint == "" {
+		return nil, errors.New("initiate file download failed: no simple download protocol")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(token.TokenHeader, revaToken)
+	req.Header.Set(transferTokenHeader, transferToken)
+
+	r, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if r.StatusCode != http.StatusOK {
+		r.Body.Close()
+		return nil, fmt.Errorf("download failed: status code %d", r.StatusCode)
+	}
+
+	return r.Body, nil
+}
+
+// upload writes the content to the referenced file through the reva data gateway.
+func (p WopiServer) upload(ctx context.Context, ref *provider.Reference, revaToken string, content io.Reader, length int64) error {
+	ctx = metadata.AppendToOutgoingContext(ctx, token.TokenHeader, revaToken)
+
+	rsp, err := p.client.InitiateFileUpload(ctx, &provider.InitiateFileUploadRequest{
+		Ref: ref,
+		Opaque: &types.Opaque{
+			Map: map[string]*types.OpaqueEntry{
+				"Upload-Length": {
+					Decoder: "plain",
+					Value:   []byte(strconv.FormatInt(length, 10)),
+				},
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if rsp.Status.Code != rpc.Code_CODE_OK {
+		return fmt.Errorf("initiate file upload failed: %w", cs3StatusErr{rsp.Status})
+	}
+
+	var proto *gateway.FileUploadProtocol
+	for _, up := range rsp.Protocols {
+		if up.Protocol == simpleProtocol {
+			proto = up
+			break
+		}
+	}
+	if proto == nil {
+		return errors.New("initiate file upload failed: no simple upload protocol")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, proto.UploadEndpoint, content)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = length
+	req.Header.Set(token.TokenHeader, revaToken)
+	req.Header.Set(transferTokenHeader, proto.Token)
+
+	r, err := p.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+
+	if r.StatusCode != http.StatusOK && r.StatusCode != http.StatusCreated && r.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("upload failed: status code %d", r.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,63 @@
+package svc
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"unicode/utf16"
+)
+
+// decodeUTF7 decodes the UTF-7 (RFC 2152) encoded file names which WOPI clients send in
+// the X-WOPI-SuggestedTarget, X-WOPI-RelativeTarget and X-WOPI-RequestedName headers.
+// Characters outside of the encoded sections are kept as they are.
+func decodeUTF7(s string) (string, error) {
+	var b strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		if s[i] != '+' {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		end := i + 1
+		for end < len(s) && isModifiedBase64(s[end]) {
+			end++
+		}
+
+		if end == i+1 {
+			// "+-" encodes a plain "+"
+			if end < len(s) && s[end] == '-' {
+				b.WriteByte('+')
+				i = end
+				continue
+			}
+			return "", errors.New("invalid UTF-7 shift sequence")
+		}
+
+		raw, err := base64.RawStdEncoding.DecodeString(s[i+1 : end])
+		if err != nil {
+			return "", err
+		}
+		if len(raw)%2 != 0 {
+			return "", errors.New("invalid UTF-7 shift sequence")
+		}
+
+		units := make([]uint16, len(raw)/2)
+		for k := range units {
+			units[k] = uint16(raw[2*k])<<8 | uint16(raw[2*k+1])
+		}
+		b.WriteString(string(utf16.Decode(units)))
+
+		// an explicit "-" terminates the shift sequence and is absorbed
+		if end < len(s) && s[end] == '-' {
+			end++
+		}
+		i = end - 1
+	}
+
+	return b.String(), nil
+}
+
+func isModifiedBase64(c byte) bool {
+	return c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '+' || c == '/'
+}
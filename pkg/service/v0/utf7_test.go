@@ -0,0 +1,33 @@
+package svc
+
+import "testing"
+
+func TestDecodeUTF7(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "report.docx", want: "report.docx"},
+		{in: "", want: ""},
+		{in: "A+-B.docx", want: "A+B.docx"},
+		{in: "+AOQ-rger.docx", want: "ärger.docx"},
+		{in: "+AOQ.docx", want: "ä.docx"},
+		{in: "Hi Mom -+Jjo--!", want: "Hi Mom -☺-!"},
+		{in: "+ZeVnLIqe-", want: "日本語"},
+		{in: "+", wantErr: true},
+		{in: "+!", wantErr: true},
+		{in: "+AO-", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := decodeUTF7(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeUTF7(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("decodeUTF7(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package svc
+
+import (
+	"fmt"
+	"strings"
+
+	appprovider "github.com/cs3org/go-cs3apis/cs3/app/provider/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+)
+
+// viewModeAliases are the short names accepted for the viewMode request parameter
+// in addition to the CS3 view mode names.
+var viewModeAliases = map[string]appprovider.OpenInAppRequest_ViewMode{
+	"view":  appprovider.OpenInAppRequest_VIEW_MODE_VIEW_ONLY,
+	"read":  appprovider.OpenInAppRequest_VIEW_MODE_READ_ONLY,
+	"write": appprovider.OpenInAppRequest_VIEW_MODE_READ_WRITE,
+}
+
+// parseViewMode parses the viewMode request parameter. An empty parameter
+// results in VIEW_MODE_INVALID, which means that no view mode was requested.
+func parseViewMode(s string) (appprovider.OpenInAppRequest_ViewMode, error) {
+	if s == "" {
+		return appprovider.OpenInAppRequest_VIEW_MODE_INVALID, nil
+	}
+	if mode, ok := viewModeAliases[strings.ToLower(s)]; ok {
+		return mode, nil
+	}
+	if mode, ok := appprovider.OpenInAppRequest_ViewMode_value[strings.ToUpper(s)]; ok && mode != int32(appprovider.OpenInAppRequest_VIEW_MODE_INVALID) {
+		return appprovider.OpenInAppRequest_ViewMode(mode), nil
+	}
+	return appprovider.OpenInAppRequest_VIEW_MODE_INVALID, fmt.Errorf("unknown view mode %s", s)
+}
+
+// maxViewMode returns the highest view mode the permissions allow:
+// read-write needs download and upload, read-only needs download and view-only needs stat.
+// View-only sessions get the content through the service, see contentToken.
+func maxViewMode(perms *provider.ResourcePermissions) appprovider.OpenInAppRequest_ViewMode {
+	switch {
+	case perms == nil:
+		return appprovider.OpenInAppRequest_VIEW_MODE_INVALID
+	case perms.InitiateFileDownload && perms.InitiateFileUpload:
+		return appprovider.OpenInAppRequest_VIEW_MODE_READ_WRITE
+	case perms.InitiateFileDownload:
+		return appprovider.OpenInAppRequest_VIEW_MODE_READ_ONLY
+	case perms.Stat:
+		return appprovider.OpenInAppRequest_VIEW_MODE_VIEW_ONLY
+	default:
+		return appprovider.OpenInAppRequest_VIEW_MODE_INVALID
+	}
+}
+
+// viewMode returns the requested view mode capped to the highest view mode the permissions allow.
+// The view modes are ordered from view-only to read-write, so the lower one wins.
+func viewMode(requested appprovider.OpenInAppRequest_ViewMode, perms *provider.ResourcePermissions) appprovider.OpenInAppRequest_ViewMode {
+	allowed := maxViewMode(perms)
+	if requested != appprovider.OpenInAppRequest_VIEW_MODE_INVALID && requested < allowed {
+		return requested
+	}
+	return allowed
+}
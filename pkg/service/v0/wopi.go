@@ -0,0 +1,273 @@
+package svc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	merrors "github.com/asim/go-micro/v3/errors"
+	appprovider "github.com/cs3org/go-cs3apis/cs3/app/provider/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/cs3org/reva/pkg/token"
+	"github.com/go-chi/chi"
+	"github.com/owncloud/ocis-wopiserver/pkg/audit"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	headerWopiOverride          = "X-WOPI-Override"
+	headerWopiLock              = "X-WOPI-Lock"
+	headerWopiOldLock           = "X-WOPI-OldLock"
+	headerWopiLockFailureReason = "X-WOPI-LockFailureReason"
+	headerWopiItemVersion       = "X-WOPI-ItemVersion"
+)
+
+type accessTokenClaimsKey struct{}
+
+// CheckFileInfoResponse is the response of the WOPI CheckFileInfo operation.
+// https://wopi.readthedocs.io/projects/wopirest/en/latest/files/CheckFileInfo.html
+type CheckFileInfoResponse struct {
+	BaseFileName            string `json:"BaseFileName"`
+	OwnerID                 string `json:"OwnerId"`
+	Size                    uint64 `json:"Size"`
+	UserID                  string `json:"UserId"`
+	UserFriendlyName        string `json:"UserFriendlyName"`
+	Version                 string `json:"Version"`
+	LastModifiedTime        string `json:"LastModifiedTime,omitempty"`
+	ReadOnly                bool   `json:"ReadOnly"`
+	UserCanWrite            bool   `json:"UserCanWrite"`
+	UserCanNotWriteRelative bool   `json:"UserCanNotWriteRelative"`
+	SupportsUpdate          bool   `json:"SupportsUpdate"`
+	SupportsLocks           bool   `json:"SupportsLocks"`
+	SupportsGetLock         bool   `json:"SupportsGetLock"`
+	SupportsRename          bool   `json:"SupportsRename"`
+	UserCanRename           bool   `json:"UserCanRename"`
+	DisablePrint            bool   `json:"DisablePrint"`
+	DisableExport           bool   `json:"DisableExport"`
+	DisableCopy             bool   `json:"DisableCopy"`
+	HidePrintOption         bool   `json:"HidePrintOption"`
+	HideSaveOption          bool   `json:"HideSaveOption"`
+	HideExportOption        bool   `json:"HideExportOption"`
+}
+
+// WopiContext validates the access token of a WOPI request and adds its claims to the request context.
+func (p WopiServer) WopiContext(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, err := parseAccessToken(r.URL.Query().Get("access_token"), p.config.WopiServer.Secret)
+		if err != nil {
+			p.logger.Debug().Err(err).Msg("invalid WOPI access token")
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		resourceID := unwrapResourceID(chi.URLParam(r, "fileid"))
+		if resourceID == nil || resourceID.StorageId != claims.StorageID || resourceID.OpaqueId != claims.OpaqueID {
+			p.logger.Debug().Str("fileid", chi.URLParam(r, "fileid")).Msg("WOPI access token was issued for another file")
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), accessTokenClaimsKey{}, claims)))
+	})
+}
+
+func accessTokenClaimsFromContext(ctx context.Context) *accessTokenClaims {
+	return ctx.Value(accessTokenClaimsKey{}).(*accessTokenClaims)
+}
+
+// CheckFileInfo implements the WOPI CheckFileInfo operation.
+func (p WopiServer) CheckFileInfo(w http.ResponseWriter, r *http.Request) {
+	claims := accessTokenClaimsFromContext(r.Context())
+
+	statResponse, err := p.stat(r.Context(), chi.URLParam(r, "fileid"), claims.RevaToken)
+	if err != nil {
+		p.logger.Error().Err(err).Msg("CheckFileInfo: could not stat file")
+		w.WriteHeader(wopiStatus(err))
+		return
+	}
+	info := statResponse.Info
+
+	canWrite := claims.canWrite() && info.GetPermissionSet().GetInitiateFileUpload()
+	viewOnly := claims.ViewMode == appprovider.OpenInAppRequest_VIEW_MODE_VIEW_ONLY
+
+	fileInfo := CheckFileInfoResponse{
+		BaseFileName:            filepath.Base(info.Path),
+		Size:                    info.Size,
+		UserID:                  claims.UserID,
+		UserFriendlyName:        claims.UserName,
+		Version:                 itemVersion(info),
+		ReadOnly:                !canWrite,
+		UserCanWrite:            canWrite,
+		UserCanNotWriteRelative: !canWrite,
+		SupportsUpdate:          true,
+		SupportsLocks:           true,
+		SupportsGetLock:         true,
+		SupportsRename:          true,
+		UserCanRename:           canWrite && info.GetPermissionSet().GetMove(),
+		// view-only sessions must not leak the content of the file
+		DisablePrint:     viewOnly,
+		DisableExport:    viewOnly,
+		DisableCopy:      viewOnly,
+		HidePrintOption:  viewOnly,
+		HideSaveOption:   viewOnly,
+		HideExportOption: viewOnly,
+	}
+	if info.Owner != nil {
+		fileInfo.OwnerID = info.Owner.OpaqueId
+	}
+	if info.Mtime != nil {
+		fileInfo.LastModifiedTime = time.Unix(int64(info.Mtime.Seconds), int64(info.Mtime.Nanos)).UTC().Format(time.RFC3339Nano)
+	}
+
+	js, err := json.Marshal(fileInfo)
+	if err != nil {
+		p.logger.Error().Err(err).Msg("CheckFileInfo: could not marshal response")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(js)
+}
+
+// FileOperation dispatches the WOPI operations on a file which are selected by the X-WOPI-Override header.
+func (p WopiServer) FileOperation(w http.ResponseWriter, r *http.Request) {
+	switch r.Header.Get(headerWopiOverride) {
+	case "LOCK":
+		p.Lock(w, r)
+	case "GET_LOCK":
+		p.GetLock(w, r)
+	case "REFRESH_LOCK":
+		p.RefreshLock(w, r)
+	case "UNLOCK":
+		p.Unlock(w, r)
+	case "PUT_RELATIVE":
+		p.PutRelativeFile(w, r)
+	case "RENAME_FILE":
+		p.RenameFile(w, r)
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+// GetFile implements the WOPI GetFile operation.
+func (p WopiServer) GetFile(w http.ResponseWriter, r *http.Request) {
+	claims := accessTokenClaimsFromContext(r.Context())
+
+	statResponse, err := p.stat(r.Context(), chi.URLParam(r, "fileid"), claims.RevaToken)
+	if err != nil {
+		p.logger.Error().Err(err).Msg("GetFile: could not stat file")
+		w.WriteHeader(wopiStatus(err))
+		return
+	}
+
+	revaToken, err := p.contentToken(r.Context(), claims, statResponse.Info)
+	if err != nil {
+		p.logger.Error().Err(err).Msg("GetFile: could not mint content token")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	content, err := p.download(r.Context(), &provider.Reference{ResourceId: claims.resourceID()}, revaToken)
+	if err != nil {
+		p.logger.Error().Err(err).Msg("GetFile: could not download file")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer content.Close()
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set(headerWopiItemVersion, itemVersion(statResponse.Info))
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, content); err != nil {
+		p.logger.Error().Err(err).Msg("GetFile: could not write file content")
+	}
+}
+
+// PutFile implements the WOPI PutFile operation.
+func (p WopiServer) PutFile(w http.ResponseWriter, r *http.Request) {
+	claims := accessTokenClaimsFromContext(r.Context())
+
+	if !claims.canWrite() {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	// the storage needs the size before the upload starts
+	if r.ContentLength < 0 {
+		w.WriteHeader(http.StatusLengthRequired)
+		return
+	}
+
+	statResponse, err := p.stat(r.Context(), chi.URLParam(r, "fileid"), claims.RevaToken)
+	if err != nil {
+		p.logger.Error().Err(err).Msg("PutFile: could not stat file")
+		w.WriteHeader(wopiStatus(err))
+		return
+	}
+
+	revaToken, err := p.serviceToken(r.Context(), claims)
+	if err != nil {
+		p.logger.Error().Err(err).Msg("PutFile: could not mint service token")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	ctx := metadata.AppendToOutgoingContext(r.Context(), token.TokenHeader, revaToken)
+	defer p.fileMutex.lock(lockKey(claims.resourceID()))()
+	if !p.checkLock(ctx, w, claims, r.Header.Get(headerWopiLock), statResponse.Info.Size) {
+		return
+	}
+
+	ref := &provider.Reference{ResourceId: claims.resourceID()}
+	if err := p.upload(r.Context(), ref, claims.RevaToken, r.Body, r.ContentLength); err != nil {
+		p.logger.Error().Err(err).Msg("PutFile: could not upload file")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	statResponse, err = p.stat(r.Context(), chi.URLParam(r, "fileid"), claims.RevaToken)
+	if err != nil {
+		p.logger.Error().Err(err).Msg("PutFile: could not stat file")
+		w.WriteHeader(wopiStatus(err))
+		return
+	}
+
+	p.audit(r, audit.Event{
+		Action:   audit.ActionSave,
+		UserID:   claims.UserID,
+		UserName: claims.UserName,
+		FileID:   wrapResourceID(statResponse.Info.Id),
+		Path:     statResponse.Info.Path,
+		ViewMode: claims.ViewMode.String(),
+		App:      claims.App,
+	})
+
+	w.Header().Set(headerWopiItemVersion, itemVersion(statResponse.Info))
+	w.WriteHeader(http.StatusOK)
+}
+
+// itemVersion returns the WOPI version of a file, which changes whenever the file content changes.
+func itemVersion(info *provider.ResourceInfo) string {
+	return strings.Trim(info.Etag, `"`)
+}
+
+// wopiStatus maps errors returned by stat to the status codes expected by WOPI clients:
+// 401 if the token is not accepted, 404 if the file is unknown or the user may not access it.
+func wopiStatus(err error) int {
+	var e *merrors.Error
+	if !errors.As(err, &e) {
+		return http.StatusInternalServerError
+	}
+	switch e.Code {
+	case http.StatusUnauthorized:
+		return http.StatusUnauthorized
+	case http.StatusNotFound, http.StatusForbidden:
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
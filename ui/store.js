@@ -1,23 +1,50 @@
+import axios from 'axios'
+
+import { appInfo, newExtensions } from './extensions'
+
 const state = {
-  config: null
+  config: null,
+  extensions: null
 }
 
 const getters = {
   config: state => state.config,
+  extensions: state => state.extensions,
   getServerForJsClient: (state, getters, rootState, rootGetters) => rootGetters.configuration.server.replace(/\/$/, ''),
   accessToken: (state, getters, rootState, rootGetters) => rootGetters.user.token
 }
 
 const actions = {
   // Used by ocis-web.
-  loadConfig ({ commit }, config) {
+  loadConfig ({ commit, dispatch }, config) {
     commit('LOAD_CONFIG', config)
+    return dispatch('loadExtensions')
+  },
+  // Loads the extensions the WOPI apps handle from their discovery, which needs the server
+  // from the configuration of ocis-web. The built-in extensions stay registered, so they are
+  // used if loading fails.
+  loadExtensions ({ commit, getters }) {
+    return axios.get(getters.getServerForJsClient + '/api/v0/wopi/extensions')
+      .then(response => {
+        commit('SET_EXTENSIONS', response.data)
+        const extensions = newExtensions(response.data)
+        if (extensions.length > 0) {
+          appInfo.extensions.push(...extensions)
+          commit('REGISTER_APP', { ...appInfo, extensions }, { root: true })
+        }
+      })
+      .catch(error => {
+        console.error('loading the WOPI extensions failed, using the built-in ones', error)
+      })
   }
 }
 
 const mutations = {
   LOAD_CONFIG (state, config) {
     state.config = config
+  },
+  SET_EXTENSIONS (state, extensions) {
+    state.extensions = extensions
   }
 }
 